@@ -108,6 +108,15 @@ func JSONRaw(data []byte, other ...Option) Response {
 	)
 }
 
+func Data(contentType string, data []byte, other ...Option) Response {
+	return NewResponse(
+		append([]Option{
+			WithHeader("Content-Type", contentType),
+			WithBody(data),
+		}, other...)...,
+	)
+}
+
 func BadRequest() Response {
 	return Status(http.StatusBadRequest)
 }
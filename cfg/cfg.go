@@ -1,9 +1,14 @@
 package cfg
 
 import (
+	"fmt"
 	"github.com/gofrs/flock"
+	"io/ioutil"
 	"log"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const TimeFormatFS = "02012006_150405"
@@ -21,10 +26,29 @@ type ServerConfig struct {
 }
 
 type NeuralNetworkConfig struct {
-	ConfigFile  string //darknet config file
-	WeightsFile string //darknet weights file
-	DataFile    string //darknet data file
-	Clear       bool   //will clear training statistics
+	ConfigFile    string        //darknet config file
+	WeightsFile   string        //darknet weights file
+	DataFile      string        //darknet data file
+	Clear         bool          //will clear training statistics
+	Resume        string        //id of the training session to resume
+	GPUs          []int         //indexes of the gpus to train on
+	CalcMAP       bool          //calculate the mAP during training
+	MJPEGPort     int           //port serving the training chart as mjpeg, zero disables it
+	Benchmark     bool          //benchmark the layers during training
+	NoAutoCfg     bool          //train with the network config as is instead of adjusting it to the number of classes
+	BackendName   string        //darknet backend implementation
+	Thresh        float64       //default detection threshold
+	HierThresh    float64       //default hierarchical detection threshold
+	NMS           float64       //default non-maximum suppression threshold
+	PreResize     bool          //resize images to the network input size in go
+	PoolSize      int           //number of networks loaded for concurrent inference
+	PoolQueueSize int           //number of detections allowed to wait for a network
+	PoolWait      time.Duration //maximum duration a detection waits for a network
+	BatchSize     int           //number of images detected in a single pass through a network
+	BatchWindow   time.Duration //maximum duration an image waits for a batch to fill up
+	WatchInterval time.Duration //interval at which the model files are polled for changes, zero disables polling
+	ModelsFile    string        //json file of additional named models
+	ModelsMemory  int64         //memory budget in bytes of the loaded models, zero is unlimited
 }
 
 func (c *AppConfig) TrainingLogPath() string {
@@ -39,6 +63,14 @@ func (c *AppConfig) TrainingBasePath() string {
 	return filepath.Join(c.Storage, "train")
 }
 
+func (c *AppConfig) TrainingSessionPath(id string) string {
+	return filepath.Join(c.TrainingBasePath(), id)
+}
+
+func (c *AppConfig) TrainingQueuePath() string {
+	return filepath.Join(c.Storage, "queue.json")
+}
+
 func (c *AppConfig) ValidateStatsPath() string {
 	return filepath.Join(c.Storage, "validate.json")
 }
@@ -47,10 +79,31 @@ func (c *AppConfig) DatasetPath() string {
 	return filepath.Join(c.Storage, "dataset")
 }
 
+func (c *AppConfig) QuarantinePath() string {
+	return filepath.Join(c.Storage, "quarantine")
+}
+
 func (c *AppConfig) LockTraining() *flock.Flock {
 	return flock.New(filepath.Join(c.Storage, "train.lock"))
 }
 
+// TrainingPID returns the process holding the training lock, which the train command records in the lock file
+func (c *AppConfig) TrainingPID() (int, error) {
+	buf, err := ioutil.ReadFile(c.LockTraining().Path())
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("the training lock does not record a process")
+	}
+	return pid, nil
+}
+
+func (c *AppConfig) LockDataset() *flock.Flock {
+	return flock.New(filepath.Join(c.Storage, "dataset.lock"))
+}
+
 func (c *AppConfig) IsTraining() bool {
 	lock := c.LockTraining()
 	ok, err := lock.TryLock()
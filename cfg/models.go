@@ -0,0 +1,43 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ModelConfig is the config/weights/data triple of a model
+type ModelConfig struct {
+	Config  string `json:"config"`
+	Weights string `json:"weights"`
+	Data    string `json:"data"`
+}
+
+// ReadModelsFile reads a json object of named models, e.g. {"coco": {"config": "...", "weights": "...", "data": "..."}}.
+// Relative paths are resolved against the directory of the models file.
+func ReadModelsFile(file string) (map[string]*ModelConfig, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	models := map[string]*ModelConfig{}
+	if err := json.NewDecoder(f).Decode(&models); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	dir := filepath.Dir(file)
+	for name, model := range models {
+		if model == nil || model.Config == "" || model.Weights == "" || model.Data == "" {
+			return nil, fmt.Errorf("%s: model %q requires config, weights and data", file, name)
+		}
+		for _, p := range []*string{&model.Config, &model.Weights, &model.Data} {
+			if !filepath.IsAbs(*p) {
+				*p = filepath.Join(dir, *p)
+			}
+		}
+	}
+	return models, nil
+}
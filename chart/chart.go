@@ -0,0 +1,268 @@
+package chart
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// Chart is a line chart of one or more panels stacked on top of each other, sharing the x axis
+type Chart struct {
+	Title  string
+	XLabel string
+	Width  int //in pixels
+	Height int //in pixels
+	Panels []*Panel
+}
+
+// Panel is a plot area with a y axis on the left, and on the right if any series uses it
+type Panel struct {
+	Weight float64 //share of the chart height, panels weigh 1 by default
+	Left   string  //left y axis label
+	Right  string  //right y axis label
+	Series []*Series
+}
+
+// Series is a line of points ordered by x
+type Series struct {
+	Name    string
+	Color   color.RGBA
+	Right   bool //plotted against the right y axis
+	Markers bool //draws a marker at every point, for sparse series
+	Points  []Point
+}
+
+type Point struct {
+	X, Y float64
+}
+
+const (
+	anchorStart = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// canvas is the drawing surface of a rendered chart, y grows downwards
+type canvas interface {
+	rect(x, y, w, h float64, c color.RGBA)
+	line(x1, y1, x2, y2 float64, c color.RGBA)
+	polyline(points []Point, c color.RGBA)
+	marker(x, y float64, c color.RGBA)
+	text(x, y float64, s string, c color.RGBA, anchor int) //y is the baseline
+}
+
+var (
+	background = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	foreground = color.RGBA{R: 40, G: 40, B: 40, A: 255}
+	grid       = color.RGBA{R: 225, G: 225, B: 225, A: 255}
+)
+
+const (
+	margin     = 60 //room for the axis labels left and right of the panels
+	lineHeight = 16
+	tickCount  = 5
+)
+
+// draw lays out the chart onto c
+func (ch *Chart) draw(c canvas) {
+	w, h := float64(ch.Width), float64(ch.Height)
+	c.rect(0, 0, w, h, background)
+
+	top := float64(lineHeight)
+	if ch.Title != "" {
+		c.text(w/2, top, ch.Title, foreground, anchorMiddle)
+		top += lineHeight / 2
+	}
+	legend := ch.legend()
+	bottom := h - 2*lineHeight
+	if ch.XLabel != "" {
+		bottom -= lineHeight
+	}
+	if len(legend) > 0 {
+		bottom -= lineHeight
+	}
+
+	xMin, xMax := ch.xRange()
+	left, right := float64(margin), w-margin
+	xScale := func(x float64) float64 {
+		return left + (x-xMin)/(xMax-xMin)*(right-left)
+	}
+
+	var weights float64
+	for _, p := range ch.Panels {
+		weights += p.weight()
+	}
+	y := top
+	for _, p := range ch.Panels {
+		height := (bottom - top) * p.weight() / weights
+		//leave room above each panel for its axis labels
+		p.draw(c, left, y+lineHeight, right-left, height-lineHeight-4, xScale)
+		y += height
+	}
+
+	for _, tick := range ticks(xMin, xMax) {
+		c.text(xScale(tick), bottom+lineHeight, formatTick(tick), foreground, anchorMiddle)
+	}
+	y = bottom + 2*lineHeight
+	if ch.XLabel != "" {
+		c.text((left+right)/2, y, ch.XLabel, foreground, anchorMiddle)
+		y += lineHeight
+	}
+
+	//the legend is a single row of colored names
+	x := left
+	for _, s := range legend {
+		c.line(x, y-4, x+16, y-4, s.Color)
+		c.text(x+20, y, s.Name, foreground, anchorStart)
+		x += 20 + float64(7*len(s.Name)) + 16
+	}
+}
+
+func (ch *Chart) legend() []*Series {
+	var series []*Series
+	for _, p := range ch.Panels {
+		for _, s := range p.Series {
+			if s.Name != "" {
+				series = append(series, s)
+			}
+		}
+	}
+	return series
+}
+
+func (ch *Chart) xRange() (float64, float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, p := range ch.Panels {
+		for _, s := range p.Series {
+			for _, pt := range s.Points {
+				min = math.Min(min, pt.X)
+				max = math.Max(max, pt.X)
+			}
+		}
+	}
+	return niceRange(min, max, false)
+}
+
+func (p *Panel) weight() float64 {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+func (p *Panel) draw(c canvas, x, y, w, h float64, xScale func(float64) float64) {
+	var axes [2]struct {
+		used     bool
+		min, max float64
+	}
+	for i := range axes {
+		axes[i].min, axes[i].max = math.Inf(1), math.Inf(-1)
+	}
+	for _, s := range p.Series {
+		a := &axes[0]
+		if s.Right {
+			a = &axes[1]
+		}
+		a.used = true
+		for _, pt := range s.Points {
+			a.min = math.Min(a.min, pt.Y)
+			a.max = math.Max(a.max, pt.Y)
+		}
+	}
+	scales := [2]func(float64) float64{}
+	for i := range axes {
+		min, max := niceRange(axes[i].min, axes[i].max, true)
+		scales[i] = func(v float64) float64 {
+			return y + h - (v-min)/(max-min)*h
+		}
+		if i == 1 && !axes[i].used {
+			continue
+		}
+		for _, tick := range ticks(min, max) {
+			ty := scales[i](tick)
+			if i == 0 {
+				c.line(x, ty, x+w, ty, grid)
+				c.text(x-4, ty+4, formatTick(tick), foreground, anchorEnd)
+			} else {
+				c.text(x+w+4, ty+4, formatTick(tick), foreground, anchorStart)
+			}
+		}
+	}
+	c.line(x, y, x, y+h, foreground)
+	c.line(x+w, y, x+w, y+h, foreground)
+	c.line(x, y+h, x+w, y+h, foreground)
+	c.line(x, y, x+w, y, foreground)
+	if p.Left != "" {
+		c.text(x, y-4, p.Left, foreground, anchorStart)
+	}
+	if p.Right != "" {
+		c.text(x+w, y-4, p.Right, foreground, anchorEnd)
+	}
+
+	for _, s := range p.Series {
+		scale := scales[0]
+		if s.Right {
+			scale = scales[1]
+		}
+		points := make([]Point, len(s.Points))
+		for i, pt := range s.Points {
+			points[i] = Point{X: xScale(pt.X), Y: scale(pt.Y)}
+		}
+		c.polyline(points, s.Color)
+		if s.Markers {
+			for _, pt := range points {
+				c.marker(pt.X, pt.Y, s.Color)
+			}
+		}
+	}
+
+}
+
+// niceRange widens min and max to a range the ticks divide evenly, including zero if fromZero and the values are
+// non-negative
+func niceRange(min, max float64, fromZero bool) (float64, float64) {
+	if math.IsInf(min, 0) || math.IsInf(max, 0) {
+		return 0, 1
+	}
+	if fromZero && min >= 0 {
+		min = 0
+	}
+	if max-min <= 0 {
+		max = min + math.Max(math.Abs(min), 1)
+	}
+	step := tickStep(min, max)
+	return math.Floor(min/step) * step, math.Ceil(max/step) * step
+}
+
+// tickStep returns a step of 1, 2 or 5 times a power of ten dividing min to max into about tickCount ticks
+func tickStep(min, max float64) float64 {
+	raw := (max - min) / tickCount
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, f := range []float64{1, 2, 5} {
+		if f*magnitude >= raw {
+			return f * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func ticks(min, max float64) []float64 {
+	step := tickStep(min, max)
+	var ts []float64
+	for i := 0; ; i++ {
+		v := min + float64(i)*step
+		if v > max+step/2 {
+			break
+		}
+		ts = append(ts, v)
+	}
+	return ts
+}
+
+func formatTick(v float64) string {
+	if v != 0 && math.Abs(v) < 0.01 {
+		return strconv.FormatFloat(v, 'e', 0, 64)
+	}
+	return fmt.Sprint(math.Round(v*1000) / 1000)
+}
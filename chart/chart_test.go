@@ -0,0 +1,82 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func testChart() *Chart {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	return &Chart{
+		Title:  "loss <& mAP>",
+		XLabel: "iteration",
+		Width:  400,
+		Height: 300,
+		Panels: []*Panel{
+			{
+				Series: []*Series{
+					{Name: "loss", Color: red, Points: []Point{{0, 4}, {50, 2}, {100, 1}}},
+					{Name: "mAP", Color: blue, Right: true, Markers: true, Points: []Point{{50, 0.2}, {100, 0.6}}},
+				},
+			},
+		},
+	}
+}
+
+func TestChart_SVG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, testChart().SVG(buf))
+
+	//the document is well formed
+	decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	var polylines, circles int
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "polyline":
+				polylines++
+			case "circle":
+				circles++
+			}
+		}
+	}
+	require.Equal(t, 2, polylines)
+	require.Equal(t, 2, circles)
+	require.Contains(t, buf.String(), "loss &lt;&amp; mAP&gt;")
+}
+
+func TestChart_Image(t *testing.T) {
+	img := testChart().Image()
+	require.Equal(t, image.Rect(0, 0, 400, 300), img.Bounds())
+
+	colors := map[color.RGBA]bool{}
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			colors[img.RGBAAt(x, y)] = true
+		}
+	}
+	require.True(t, colors[color.RGBA{R: 255, A: 255}], "loss is drawn")
+	require.True(t, colors[color.RGBA{B: 255, A: 255}], "mAP is drawn")
+	require.True(t, colors[background])
+}
+
+func TestNiceRange(t *testing.T) {
+	min, max := niceRange(0.3, 9.2, true)
+	require.Equal(t, 0.0, min)
+	require.Equal(t, 10.0, max)
+	require.Equal(t, []float64{0, 2, 4, 6, 8, 10}, ticks(min, max))
+
+	min, max = niceRange(3, 3, false)
+	require.True(t, min <= 3 && max > 3)
+}
@@ -0,0 +1,71 @@
+package chart
+
+import (
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Image renders the chart as an image
+func (ch *Chart) Image() *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, ch.Width, ch.Height))
+	ch.draw(&rasterCanvas{dst: dst, face: basicfont.Face7x13})
+	return dst
+}
+
+type rasterCanvas struct {
+	dst  *image.RGBA
+	face font.Face
+}
+
+func (c *rasterCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	r := image.Rect(int(x), int(y), int(math.Ceil(x+w)), int(math.Ceil(y+h)))
+	draw.Draw(c.dst, r.Intersect(c.dst.Bounds()), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+// line draws a one pixel wide line by stepping along its longest axis
+func (c *rasterCanvas) line(x1, y1, x2, y2 float64, col color.RGBA) {
+	steps := math.Max(math.Abs(x2-x1), math.Abs(y2-y1))
+	if steps < 1 {
+		steps = 1
+	}
+	for i := 0.0; i <= steps; i++ {
+		x := x1 + (x2-x1)*i/steps
+		y := y1 + (y2-y1)*i/steps
+		c.dst.SetRGBA(int(math.Round(x)), int(math.Round(y)), col)
+	}
+}
+
+func (c *rasterCanvas) polyline(points []Point, col color.RGBA) {
+	for i := 1; i < len(points); i++ {
+		c.line(points[i-1].X, points[i-1].Y, points[i].X, points[i].Y, col)
+	}
+	if len(points) == 1 {
+		c.marker(points[0].X, points[0].Y, col)
+	}
+}
+
+func (c *rasterCanvas) marker(x, y float64, col color.RGBA) {
+	c.rect(x-2, y-2, 5, 5, col)
+}
+
+func (c *rasterCanvas) text(x, y float64, s string, col color.RGBA, anchor int) {
+	width := font.MeasureString(c.face, s).Ceil()
+	switch anchor {
+	case anchorMiddle:
+		x -= float64(width) / 2
+	case anchorEnd:
+		x -= float64(width)
+	}
+	drawer := &font.Drawer{
+		Dst:  c.dst,
+		Src:  image.NewUniform(col),
+		Face: c.face,
+		Dot:  fixed.P(int(math.Round(x)), int(math.Round(y))),
+	}
+	drawer.DrawString(s)
+}
@@ -0,0 +1,76 @@
+package chart
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// SVG writes the chart to w as an SVG document
+func (ch *Chart) SVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c := &svgCanvas{w: bw}
+	c.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="12">`+"\n",
+		ch.Width, ch.Height, ch.Width, ch.Height)
+	ch.draw(c)
+	c.printf("</svg>\n")
+	if c.err != nil {
+		return c.err
+	}
+	return bw.Flush()
+}
+
+type svgCanvas struct {
+	w   io.Writer
+	err error
+}
+
+func (c *svgCanvas) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = fmt.Fprintf(c.w, format, args...)
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	c.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, y, w, h, svgColor(col))
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, col color.RGBA) {
+	c.printf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x1, y1, x2, y2, svgColor(col))
+}
+
+func (c *svgCanvas) polyline(points []Point, col color.RGBA) {
+	if len(points) == 0 {
+		return
+	}
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", p.X, p.Y)
+	}
+	c.printf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n", strings.Join(coords, " "), svgColor(col))
+}
+
+func (c *svgCanvas) marker(x, y float64, col color.RGBA) {
+	c.printf(`<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`+"\n", x, y, svgColor(col))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, col color.RGBA, anchor int) {
+	a := "start"
+	switch anchor {
+	case anchorMiddle:
+		a = "middle"
+	case anchorEnd:
+		a = "end"
+	}
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(s))
+	c.printf(`<text x="%.1f" y="%.1f" fill="%s" text-anchor="%s">%s</text>`+"\n", x, y, svgColor(col), a, escaped.String())
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
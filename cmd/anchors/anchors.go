@@ -0,0 +1,57 @@
+package anchors
+
+import (
+	"fmt"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/netbrain/darknetw/dataset"
+	"log"
+)
+
+// Run calculates n anchors for a network input of width x height from the labelled boxes of the train list, zero values
+// are taken from the network config if given. With write set the anchors are written to the [yolo] sections of the
+// network config.
+func Run(config *cfg.AppConfig, n, width, height int, write bool) error {
+	data, err := darknetcfg.ReadDataFile(config.DataFile)
+	if err != nil {
+		return err
+	}
+	var network *darknetcfg.Network
+	if config.ConfigFile != "" {
+		network, err = darknetcfg.ReadNetworkFile(config.ConfigFile)
+		if err != nil {
+			return err
+		}
+	} else if write {
+		return fmt.Errorf("writing the anchors requires a network config")
+	}
+	n, width, height, err = dataset.AnchorDefaults(network, n, width, height)
+	if err != nil {
+		return err
+	}
+
+	r, err := dataset.CalcAnchors(data, config.Storage, n, width, height)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.MissingLabels {
+		log.Printf("skipping %s, missing label file", p)
+	}
+	for _, p := range r.InvalidLabels {
+		log.Printf("skipping %s, invalid label file", p)
+	}
+	log.Printf("%d anchors of %d boxes at %dx%d, avg IoU = %.2f %%", n, r.Boxes, width, height, r.AvgIoU*100)
+	fmt.Printf("anchors = %s\n", r.Value)
+	if !write {
+		return nil
+	}
+
+	changes, err := network.SetAnchors(r.Ints())
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		log.Printf("adjusting network config %s", change)
+	}
+	return network.WriteFile(config.ConfigFile)
+}
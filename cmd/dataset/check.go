@@ -0,0 +1,50 @@
+package dataset
+
+import (
+	"fmt"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	ds "github.com/netbrain/darknetw/dataset"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// Check prints the issues of the train and valid lists, failing if there are any. With fix set, the entries with issues
+// are removed from the lists instead and their files moved to a quarantine directory along with a report, while the
+// dataset is locked against images being labelled by the api.
+func Check(config *cfg.AppConfig, fix bool) error {
+	if fix {
+		unlock, err := ds.NewWriter(config).Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	data, err := darknetcfg.ReadDataFile(config.DataFile)
+	if err != nil {
+		return err
+	}
+	r, err := ds.Check(data, config.Storage, true)
+	if err != nil {
+		return err
+	}
+	for _, issue := range r.Issues {
+		fmt.Println(issue)
+	}
+	log.Printf("%d issues in %d images", len(r.Issues), r.Images)
+	if len(r.Issues) == 0 {
+		return nil
+	}
+	if !fix {
+		return fmt.Errorf("the dataset has %d issues, --fix removes the entries with issues", len(r.Issues))
+	}
+
+	dir := filepath.Join(config.QuarantinePath(), time.Now().Format(cfg.TimeFormatFS))
+	err = ds.Fix(data, r, dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("removed %d entries and quarantined %d files in %s", len(r.Removed), len(r.Quarantined), dir)
+	return nil
+}
@@ -0,0 +1,76 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	ds "github.com/netbrain/darknetw/dataset"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// Stats reports what has been labelled in the train and valid lists, as a table or as json. Boxes are scaled to a
+// network input of width x height, zero values are taken from the network config if given.
+func Stats(config *cfg.AppConfig, width, height int, asJSON bool) error {
+	s, err := calcStats(config, width, height)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	}
+	return writeStats(os.Stdout, s)
+}
+
+func calcStats(config *cfg.AppConfig, width, height int) (*ds.Stats, error) {
+	data, err := darknetcfg.ReadDataFile(config.DataFile)
+	if err != nil {
+		return nil, err
+	}
+	var network *darknetcfg.Network
+	if config.ConfigFile != "" {
+		network, err = darknetcfg.ReadNetworkFile(config.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	width, height, err = ds.InputSize(network, width, height)
+	if err != nil {
+		return nil, err
+	}
+	return ds.CalcStats(data, config.Storage, width, height)
+}
+
+func writeStats(w io.Writer, s *ds.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "split\timages\tboxes\tunlabelled\tmissing labels\tinvalid labels\tinvalid classes")
+	for _, split := range ds.Splits {
+		ss := s.Splits[split]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", split, ss.Images, ss.Boxes, len(ss.Unlabelled), len(ss.MissingLabels), len(ss.InvalidLabels), len(ss.InvalidClasses))
+	}
+
+	fmt.Fprintln(tw, "\nclass\tname\ttrain\tvalid\tvalid share")
+	for _, c := range s.Classes {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%.1f %%\n", c.ID, c.Name, c.Train, c.Valid, c.ValidShare*100)
+	}
+
+	fmt.Fprintf(tw, "\nbox size at %dx%d\tboxes\n", s.Width, s.Height)
+	writeHistogram(tw, s.Sizes)
+	fmt.Fprintln(tw, "\naspect ratio\tboxes")
+	writeHistogram(tw, s.AspectRatios)
+	return tw.Flush()
+}
+
+func writeHistogram(w io.Writer, buckets []*ds.Bucket) {
+	for _, b := range buckets {
+		if b.Max == 0 {
+			fmt.Fprintf(w, "%g+\t%d\n", b.Min, b.Count)
+			continue
+		}
+		fmt.Fprintf(w, "%g-%g\t%d\n", b.Min, b.Max, b.Count)
+	}
+}
@@ -4,14 +4,44 @@ import (
 	"github.com/netbrain/darknetw/api"
 	"github.com/netbrain/darknetw/cfg"
 	"github.com/netbrain/darknetw/ctrl"
+	"github.com/netbrain/darknetw/darknet"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 )
 
 func Run(config *cfg.AppConfig) error {
+	backend, err := darknet.LookupBackend(config.BackendName)
+	if err != nil {
+		return err
+	}
+
+	controller := ctrl.NewDarknetController(config, backend)
+	if err := controller.DefaultPredictOptions().Validate(); err != nil {
+		return err
+	}
+
+	if config.ModelsFile != "" {
+		models, err := cfg.ReadModelsFile(config.ModelsFile)
+		if err != nil {
+			return err
+		}
+		for name, model := range models {
+			controller.RegisterModel(name, *model)
+		}
+	}
+	go func() {
+		if err := controller.RunTrainingQueue(nil); err != nil {
+			log.Println(err)
+		}
+	}()
+	if config.WatchInterval > 0 {
+		go controller.WatchModels(config.WatchInterval, nil)
+	}
+
 	router := ctrl.CreateRouter([]api.Routable{
-		ctrl.NewDarknetController(config),
+		controller,
 	}...)
 
 	srv := &http.Server{
@@ -1,22 +1,47 @@
 package train
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"fmt"
 	"github.com/netbrain/darknetw/cfg"
 	"github.com/netbrain/darknetw/darknet"
 	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/netbrain/darknetw/dataset"
 	"github.com/netbrain/darknetw/fs"
+	"github.com/netbrain/darknetw/session"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
-func Run(config *cfg.AppConfig) error {
-	var err error
+func Run(config *cfg.AppConfig) (err error) {
+	backend, err := darknet.LookupBackend(config.BackendName)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("received %s, stopping once the latest weights are saved", sig)
+			//a second signal terminates right away
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	lock := config.LockTraining()
 
 	if ok, err := lock.TryLock(); err != nil {
@@ -37,50 +62,234 @@ func Run(config *cfg.AppConfig) error {
 		}
 	}()
 
-	targetDir, datasetDir, err := createDirectoryLayout(config.Storage)
+	//stopping training signals the process recorded in the lock file
+	err = ioutil.WriteFile(lock.Path(), []byte(strconv.Itoa(os.Getpid())), 0644)
 	if err != nil {
 		return err
 	}
 
-	data, err := darknetcfg.ReadDataFile(config.DataFile)
+	s, err := startSession(config)
 	if err != nil {
 		return err
 	}
-
-	for _, k := range []darknetcfg.DarknetDataKey{darknetcfg.Train, darknetcfg.Valid} {
-		f := data.Get(k)
-		if f == "" {
-			continue
+	defer func() {
+		if e := s.Finish(err); e != nil {
+			log.Println(e)
 		}
+	}()
 
-		err = createAndLinkNewDatasetFromOriginal(data, k, f, targetDir, datasetDir, config.Storage)
+	var dataFileDst, configFileDst, weightsFileDst string
+	if config.Resume != "" {
+		dataFileDst, configFileDst, weightsFileDst = resumeFiles(s)
+	} else {
+		dataFileDst, configFileDst, weightsFileDst, err = snapshotFiles(config, s.Dir)
 		if err != nil {
 			return err
 		}
 	}
 
-	dataFileDst, configFileDst, weightsFileDst, err := modifyAndCopyDataFiles(config, data, targetDir, config.Storage)
+	err = os.Chdir(s.Dir)
 	if err != nil {
 		return err
 	}
 
-	err = os.Chdir(targetDir)
-	if err != nil {
-		return err
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-
-	darknet.TrainDetectorCustom(
+	return backend.Train(
+		ctx,
 		dataFileDst,
 		configFileDst,
 		weightsFileDst,
 		config.Clear,
-		0, //TODO make this configurable
+		s.Options.Options()...,
 	)
+}
+
+// TrainOptions returns the darknet training options of config
+func TrainOptions(config *cfg.AppConfig) *darknet.TrainOptions {
+	return darknet.NewTrainOptions(
+		darknet.WithGPUs(config.GPUs...),
+		darknet.WithCalcMAP(config.CalcMAP),
+		darknet.WithMJPEGPort(config.MJPEGPort),
+		darknet.WithBenchmarkLayers(config.Benchmark),
+	)
+}
+
+// startSession records a new training session as running, or the session to resume when config.Resume is set
+func startSession(config *cfg.AppConfig) (*session.Session, error) {
+	if config.Resume != "" {
+		return resumeSession(config)
+	}
+	options := TrainOptions(config)
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	targetDir, _, err := createDirectoryLayout(config.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session.Session{
+		Dir:     targetDir,
+		Status:  session.Running,
+		Started: time.Now(),
+		Backend: config.BackendName,
+		Source: cfg.ModelConfig{
+			Config:  config.ConfigFile,
+			Weights: config.WeightsFile,
+			Data:    config.DataFile,
+		},
+		Clear:   config.Clear,
+		Options: options,
+		PID:     os.Getpid(),
+	}
+	if config.WeightsFile != "" {
+		s.StartingWeights = "starting.weights"
+	}
+	return s, s.Save()
+}
+
+// resumeSession records the session config.Resume as running again, resuming from its latest _last weights with the
+// darknet options it was created with
+func resumeSession(config *cfg.AppConfig) (*session.Session, error) {
+	if !session.ValidID(config.Resume) {
+		return nil, fmt.Errorf("invalid training session %q", config.Resume)
+	}
+	s, err := session.Read(config.TrainingSessionPath(config.Resume))
+	if err != nil {
+		return nil, err
+	}
+	//the training lock is held, so a session left running is no longer training
+	session.MarkInterrupted([]*session.Session{s}, false)
+	if err := s.CanResume(); err != nil {
+		return nil, err
+	}
+	for _, f := range []string{"dataset.cfg", "network.cfg"} {
+		if _, err := os.Stat(filepath.Join(s.Dir, f)); err != nil {
+			return nil, fmt.Errorf("training session %s can not be resumed: %v", s.ID, err)
+		}
+	}
+
+	weights := s.StartingWeights
+	for _, w := range s.Weights {
+		if strings.HasSuffix(w.File, "_last.weights") {
+			//weights are ordered by modification time, the last one is the latest
+			weights = w.File
+		}
+	}
+	log.Printf("resuming training session %s from %s", s.ID, weights)
+
+	//sessions created before the options were recorded train with those of config
+	if s.Options == nil {
+		s.Options = TrainOptions(config)
+	}
+	if err := s.Options.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.Status = session.Running
+	s.Finished = nil
+	s.Error = ""
+	s.PID = os.Getpid()
+	//clearing the iteration count restarts counting, the iterations recorded so far are added to those reported since
+	offset := s.IterationOffset()
+	if config.Clear {
+		metrics, err := session.ReadMetrics(s.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(metrics) > 0 {
+			offset = metrics[len(metrics)-1].Iteration
+		}
+	}
+	s.Resumes = append(s.Resumes, &session.Resume{
+		Time:            time.Now(),
+		Weights:         weights,
+		Clear:           config.Clear,
+		IterationOffset: offset,
+	})
+	return s, s.Save()
+}
+
+// resumeFiles returns the data, config and weights files of a resumed session
+func resumeFiles(s *session.Session) (dataFile, configFile, weightsFile string) {
+	dataFile = filepath.Join(s.Dir, "dataset.cfg")
+	configFile = filepath.Join(s.Dir, "network.cfg")
+	if weights := s.Resumes[len(s.Resumes)-1].Weights; weights != "" {
+		weightsFile = filepath.Join(s.Dir, weights)
+	}
+	return
+}
+
+// snapshotFiles hardlinks the dataset into the session directory and copies the data, config and weights files. The
+// dataset is checked beforehand, entries with issues are left out of the snapshot. The dataset is locked against images
+// being labelled by the api meanwhile.
+func snapshotFiles(config *cfg.AppConfig, targetDir string) (dataFileDst, configFileDst, weightsFileDst string, err error) {
+	unlock, err := dataset.NewWriter(config).Lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	datasetDir := filepath.Join(targetDir, "dataset")
+	data, err := darknetcfg.ReadDataFile(config.DataFile)
+	if err != nil {
+		return
+	}
+
+	report, err := dataset.Check(data, config.Storage, false)
+	if err != nil {
+		return
+	}
+	for _, issue := range report.Issues {
+		log.Printf("skipping %s", issue)
+	}
+	if len(report.Issues) > 0 {
+		log.Printf("skipped %d of %d images, see darknetw dataset check", len(report.Issues), report.Images)
+	}
+	entries := map[darknetcfg.DarknetDataKey][]*dataset.Entry{}
+	for _, e := range report.Valid() {
+		entries[e.Split] = append(entries[e.Split], e)
+	}
+
+	for _, k := range dataset.Splits {
+		if data.Get(k) == "" {
+			continue
+		}
+
+		err = createAndLinkNewDatasetFromOriginal(data, k, entries[k], targetDir, datasetDir)
+		if err != nil {
+			return
+		}
+	}
+
+	return modifyAndCopyDataFiles(config, data, targetDir, config.Storage)
+}
+
+// Stop stops the running training session, see session.Stop
+func Stop(config *cfg.AppConfig, wait time.Duration) error {
+	s, stopped, err := session.Stop(config, wait)
+	if err != nil {
+		return err
+	}
+	if !stopped {
+		return fmt.Errorf("session %s is still stopping after %s", s.ID, wait)
+	}
+	log.Printf("session %s %s", s.ID, s.Status)
 	return nil
 }
 
 func modifyAndCopyDataFiles(config *cfg.AppConfig, dataFile *darknetcfg.DarknetData, targetDir, storageDir string) (dataFileDst, configFileDst, weightsFileDst string, err error) {
+	var classes int
 	if namesFile := dataFile.Get(darknetcfg.Names); namesFile != "" {
+		var names []string
+		names, err = dataset.ReadNames(namesFile)
+		if err != nil {
+			return
+		}
+		classes = len(names)
 		dst := filepath.Join(targetDir, "names.txt")
 		log.Printf("copying %s to %s", namesFile, dst)
 		err = fs.CopyFile(namesFile, dst)
@@ -97,6 +306,11 @@ func modifyAndCopyDataFiles(config *cfg.AppConfig, dataFile *darknetcfg.DarknetD
 	}
 
 	dataFile.Set(darknetcfg.Backup, "weights")
+	autoCfg := !config.NoAutoCfg && classes > 0
+	if v := strconv.Itoa(classes); autoCfg && dataFile.Get(darknetcfg.Classes) != v {
+		log.Printf("adjusting data file classes: %q -> %q", dataFile.Get(darknetcfg.Classes), v)
+		dataFile.Set(darknetcfg.Classes, v)
+	}
 
 	dataFileDst, err = filepath.Abs(filepath.Join(targetDir, "dataset.cfg"))
 	if err != nil {
@@ -112,8 +326,12 @@ func modifyAndCopyDataFiles(config *cfg.AppConfig, dataFile *darknetcfg.DarknetD
 	if err != nil {
 		return
 	}
-	log.Printf("copying config file to %s", configFileDst)
-	err = fs.CopyFile(config.ConfigFile, configFileDst)
+	if autoCfg {
+		err = adjustConfigFile(config.ConfigFile, configFileDst, classes)
+	} else {
+		log.Printf("copying config file to %s", configFileDst)
+		err = fs.CopyFile(config.ConfigFile, configFileDst)
+	}
 	if err != nil {
 		return
 	}
@@ -132,6 +350,23 @@ func modifyAndCopyDataFiles(config *cfg.AppConfig, dataFile *darknetcfg.DarknetD
 	return
 }
 
+// adjustConfigFile writes the config file to dst, adjusted to the number of classes of the dataset
+func adjustConfigFile(src, dst string, classes int) error {
+	network, err := darknetcfg.ReadNetworkFile(src)
+	if err != nil {
+		return err
+	}
+	changes, err := network.AdjustClasses(classes)
+	if err != nil {
+		return fmt.Errorf("%s can not be adjusted to %d classes, use --no-auto-cfg to train with it as is: %v", src, classes, err)
+	}
+	for _, change := range changes {
+		log.Printf("adjusting config file %s", change)
+	}
+	log.Printf("writing config file to %s", dst)
+	return network.WriteFile(dst)
+}
+
 func createDirectoryLayout(basePath string) (targetDir string, datasetDir string, err error) {
 	targetDir, err = filepath.Abs(filepath.Join(basePath, "train", time.Now().Format(cfg.TimeFormatFS)))
 	if err != nil {
@@ -164,7 +399,7 @@ func createDirectoryLayout(basePath string) (targetDir string, datasetDir string
 	return
 }
 
-func createAndLinkNewDatasetFromOriginal(data *darknetcfg.DarknetData, k darknetcfg.DarknetDataKey, file, targetDir, datasetDir, storageDir string) error {
+func createAndLinkNewDatasetFromOriginal(data *darknetcfg.DarknetData, k darknetcfg.DarknetDataKey, entries []*dataset.Entry, targetDir, datasetDir string) error {
 	datasetFile := filepath.Join(targetDir, fmt.Sprintf("%s.txt", k))
 	relDatasetFile, err := filepath.Rel(targetDir, datasetFile)
 	if err != nil {
@@ -178,18 +413,8 @@ func createAndLinkNewDatasetFromOriginal(data *darknetcfg.DarknetData, k darknet
 	}
 	defer fh.Close()
 
-	buf, err := ioutil.ReadFile(file)
-	if err != nil {
-		return err
-	}
-	scanner := bufio.NewScanner(bytes.NewBuffer(buf))
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		df := darknetcfg.DarknetInputFile(scanner.Text())
-		if !filepath.IsAbs(df.String()) {
-			df = darknetcfg.DarknetInputFile(filepath.Join(storageDir, string(df)))
-		}
-		for i, f := range []string{df.String(), df.StringTxt()} {
+	for _, e := range entries {
+		for i, f := range []string{e.Image.String(), e.Label()} {
 			dst := filepath.Join(datasetDir, filepath.Base(f))
 			log.Printf("hardlinking %s to %s", f, dst)
 
@@ -0,0 +1,123 @@
+package train
+
+import (
+	"bytes"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/netbrain/darknetw/session"
+	"github.com/netbrain/darknetw/test"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun_AutoCfg(t *testing.T) {
+	//training changes the working directory to the session directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+
+	for _, noAutoCfg := range []bool{false, true} {
+		config, cleanup := test.BootstrapTestEnvironment()
+		defer cleanup()
+		config.NoAutoCfg = noAutoCfg
+		require.NoError(t, ioutil.WriteFile(filepath.Join(config.Storage, "names.txt"), []byte("circle\nrectangle\ntriangle\n"), 0644))
+		for _, f := range []string{"train.txt", "valid.txt"} {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(config.Storage, f), nil, 0644))
+		}
+
+		require.NoError(t, Run(config))
+
+		sessions, err := session.List(config.TrainingBasePath())
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		network, err := darknetcfg.ReadNetworkFile(filepath.Join(sessions[0].Dir, "network.cfg"))
+		require.NoError(t, err)
+		data, err := darknetcfg.ReadDataFile(filepath.Join(sessions[0].Dir, "dataset.cfg"))
+		require.NoError(t, err)
+
+		classes, filters, maxBatches := "3", "24", "6000"
+		if noAutoCfg {
+			original, err := ioutil.ReadFile(config.ConfigFile)
+			require.NoError(t, err)
+			require.Equal(t, string(original), network.String())
+			classes, filters, maxBatches = "2", "21", "4000"
+		}
+		for _, yolo := range network.SectionsNamed("yolo") {
+			v, _ := yolo.Get("classes")
+			require.Equal(t, classes, v)
+			v, _ = network.Sections()[network.Index(yolo)-1].Get("filters")
+			require.Equal(t, filters, v)
+		}
+		v, _ := network.Net().Get("max_batches")
+		require.Equal(t, maxBatches, v)
+		if !noAutoCfg {
+			require.Equal(t, classes, data.Get(darknetcfg.Classes))
+		}
+	}
+}
+
+func TestRun_SkipsInvalidEntries(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	require.NoError(t, os.MkdirAll(config.DatasetPath(), 0755))
+	img := &bytes.Buffer{}
+	require.NoError(t, png.Encode(img, image.NewGray(image.Rect(0, 0, 4, 4))))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(config.DatasetPath(), "0.png"), img.Bytes(), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(config.DatasetPath(), "0.txt"), []byte("0 0.5 0.5 0.1 0.1"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(config.DatasetPath(), "1.txt"), []byte("0 0.5 0.5 0.1 0.1"), 0644))
+	//1.png is missing and 0.png is listed twice
+	require.NoError(t, ioutil.WriteFile(filepath.Join(config.Storage, "train.txt"), []byte("dataset/0.png\ndataset/1.png\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(config.Storage, "valid.txt"), []byte("dataset/0.png\n"), 0644))
+
+	require.NoError(t, Run(config))
+
+	sessions, err := session.List(config.TrainingBasePath())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, session.Completed, sessions[0].Status)
+	train, err := ioutil.ReadFile(filepath.Join(sessions[0].Dir, "train.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "dataset/0.png\n", string(train))
+	valid, err := ioutil.ReadFile(filepath.Join(sessions[0].Dir, "valid.txt"))
+	require.NoError(t, err)
+	require.Empty(t, valid)
+}
+
+func TestResumeSession_IterationOffset(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	dir := config.TrainingSessionPath("session")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for _, f := range []string{"dataset.cfg", "network.cfg"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, f), nil, 0644))
+	}
+	s := &session.Session{Dir: dir, Status: session.Cancelled}
+	require.NoError(t, s.Save())
+	w, err := session.OpenMetrics(dir)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(&session.Metric{Iteration: 150}))
+	require.NoError(t, w.Close())
+
+	//clearing the iteration count offsets the iterations reported since by those recorded
+	config.Resume = "session"
+	config.Clear = true
+	s, err = resumeSession(config)
+	require.NoError(t, err)
+	require.Equal(t, 150, s.IterationOffset())
+
+	//resuming without clearing keeps counting from the weights, and so keeps the offset
+	s.Status = session.Cancelled
+	require.NoError(t, s.Save())
+	config.Clear = false
+	s, err = resumeSession(config)
+	require.NoError(t, err)
+	require.Equal(t, 150, s.IterationOffset())
+}
@@ -6,10 +6,13 @@ import (
 )
 
 func Run(config *cfg.AppConfig) (err error) {
-	darknet.ValidateDetectorMap(
+	backend, err := darknet.LookupBackend(config.BackendName)
+	if err != nil {
+		return err
+	}
+	return backend.Validate(
 		config.DataFile,
 		config.ConfigFile,
 		config.WeightsFile,
 	)
-	return
 }
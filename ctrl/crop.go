@@ -0,0 +1,185 @@
+package ctrl
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/darknet/darknetrender"
+	"image"
+	"image/draw"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const cropManifestFile = "manifest.json"
+
+// PredictCrops runs detection on every image part and responds with each detection cropped from its image, along
+// with a json manifest mapping the crops to their detections. The response is multipart/mixed unless a zip archive is
+// requested through the Accept header.
+func (c *DarknetController) PredictCrops(ctx Context) Response {
+	opts, err := cropOptions(ctx.Request)
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+
+	type crop struct {
+		name        string
+		contentType string
+		buf         []byte
+	}
+	var manifest []CropResponse
+	var crops []crop
+	resp := c.detectParts(ctx.Request, func(p *predictedImage) error {
+		format := opts.Format
+		if format == "" {
+			format = encodableFormat(p.Format)
+		}
+
+		response := CropResponse{
+			File:        p.Part.FileName(),
+			Name:        p.Part.FormName(),
+			ContentType: p.Part.Header.Get("Content-Type"),
+			Crops:       []Crop{},
+		}
+		bounds := p.Image.Bounds()
+		for i, detection := range p.Detections {
+			rect := detection.Rectangle().Add(bounds.Min).Intersect(bounds)
+			if rect.Dx() < opts.MinSize || rect.Dy() < opts.MinSize || rect.Empty() {
+				continue
+			}
+			rect = rect.Inset(-opts.Padding).Intersect(bounds)
+
+			buf := &bytes.Buffer{}
+			if err := darknetrender.Encode(buf, subImage(p.Image, rect), format); err != nil {
+				return err
+			}
+			name := fmt.Sprintf("%d_%d.%s", len(manifest), i, format)
+			crops = append(crops, crop{
+				name:        name,
+				contentType: darknetrender.ContentType(format),
+				buf:         buf.Bytes(),
+			})
+			response.Crops = append(response.Crops, Crop{
+				File:      name,
+				Detection: toDetection(detection),
+				X1:        rect.Min.X - bounds.Min.X,
+				Y1:        rect.Min.Y - bounds.Min.Y,
+				X2:        rect.Max.X - bounds.Min.X,
+				Y2:        rect.Max.Y - bounds.Min.Y,
+			})
+		}
+		manifest = append(manifest, response)
+		return nil
+	})
+	if resp != nil {
+		return resp
+	}
+
+	manifestBuf, err := json.Marshal(manifest)
+	if err != nil {
+		return Error(err)
+	}
+
+	out := &bytes.Buffer{}
+	if strings.Contains(ctx.Request.Header.Get("Accept"), "application/zip") {
+		zw := zip.NewWriter(out)
+		for _, f := range append([]crop{{name: cropManifestFile, buf: manifestBuf}}, crops...) {
+			w, err := zw.Create(f.name)
+			if err != nil {
+				return Error(err)
+			}
+			if _, err := w.Write(f.buf); err != nil {
+				return Error(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return Error(err)
+		}
+		return Data("application/zip", out.Bytes(),
+			WithHeader("Content-Disposition", `attachment; filename="crops.zip"`),
+		)
+	}
+
+	mw := multipart.NewWriter(out)
+	for _, f := range append([]crop{{name: cropManifestFile, contentType: "application/json", buf: manifestBuf}}, crops...) {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", f.contentType)
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, f.name))
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return Error(err)
+		}
+		if _, err := w.Write(f.buf); err != nil {
+			return Error(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return Error(err)
+	}
+	return Data("multipart/mixed; boundary="+mw.Boundary(), out.Bytes())
+}
+
+// cropOptions parses the padding, min_size and format query parameters
+func cropOptions(r *http.Request) (opts CropOptions, err error) {
+	query := r.URL.Query()
+	for key, dst := range map[string]*int{
+		"padding":  &opts.Padding,
+		"min_size": &opts.MinSize,
+	} {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		*dst, err = strconv.Atoi(v)
+		if err != nil || *dst < 0 {
+			return opts, fmt.Errorf("%s must be a non-negative integer, got %s", key, v)
+		}
+	}
+
+	opts.Format = query.Get("format")
+	switch opts.Format {
+	case "", "jpeg", "png":
+	default:
+		return opts, fmt.Errorf("format must be either jpeg or png, got %s", opts.Format)
+	}
+	return opts, nil
+}
+
+// subImage returns the portion of img visible through rect
+func subImage(img image.Image, rect image.Rectangle) image.Image {
+	if si, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return si.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+type CropOptions struct {
+	Padding int    //pixels added around each detection
+	MinSize int    //detections narrower or lower than this are skipped
+	Format  string //jpeg or png, defaults to the format of the input image
+}
+
+type CropResponse struct {
+	File        string `json:"file"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Crops       []Crop `json:"crops"`
+}
+
+type Crop struct {
+	File      string    `json:"file"`
+	Detection Detection `json:"detection"`
+	X1        int       `json:"x1"`
+	Y1        int       `json:"y1"`
+	X2        int       `json:"x2"`
+	Y2        int       `json:"y2"`
+}
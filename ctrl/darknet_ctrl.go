@@ -3,30 +3,42 @@ package ctrl
 import (
 	"bufio"
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	. "github.com/netbrain/darknetw/api"
 	"github.com/netbrain/darknetw/cfg"
 	"github.com/netbrain/darknetw/darknet"
-	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/netbrain/darknetw/darknet/darknetrender"
+	"github.com/netbrain/darknetw/dataset"
+	"github.com/netbrain/darknetw/session"
 	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 type DarknetController struct {
-	Network *darknet.Network
+	Backend darknet.Backend
+	models  map[string]*registeredModel
+	modelMu sync.Mutex
+	queue   *TrainingQueue
+	queueMu sync.Mutex
+	events  trainingEvents
 	*cfg.AppConfig
+	datasetWriter  *dataset.Writer
 	validationPool sync.Pool //locking mechanism
 }
 
@@ -35,12 +47,71 @@ func (c *DarknetController) Routes() Routes {
 		"/api/v1/predict": {
 			POST: HandlerFn(c.Predict),
 		},
+		"/api/v1/predict/crops": {
+			POST: HandlerFn(c.PredictCrops),
+		},
+		"/api/v1/model": {
+			GET: HandlerFn(c.ReportModel),
+			PUT: HandlerFn(c.ReloadModel),
+		},
+		"/api/v1/models": {
+			GET: HandlerFn(c.ListModels),
+		},
+		"/api/v1/models/{name}": {
+			GET: HandlerFn(c.ReportModel),
+			PUT: HandlerFn(c.ReloadModel),
+		},
+		"/api/v1/models/{name}/predict": {
+			POST: HandlerFn(c.Predict),
+		},
+		"/api/v1/models/{name}/predict/crops": {
+			POST: HandlerFn(c.PredictCrops),
+		},
 		"/api/v1/label": {
 			POST: HandlerFn(c.Label),
 		},
+		"/api/v1/labels": {
+			GET: HandlerFn(c.ListLabels),
+		},
+		"/api/v1/labels/{md5}": {
+			GET:    HandlerFn(c.ReportLabel),
+			PUT:    HandlerFn(c.UpdateLabel),
+			DELETE: HandlerFn(c.DeleteLabel),
+		},
+		"/api/v1/labels/{md5}/image": {
+			GET: HandlerFn(c.ReportLabelImage),
+		},
+		"/api/v1/dataset/anchors": {
+			GET: HandlerFn(c.ReportAnchors),
+		},
+		"/api/v1/dataset/stats": {
+			GET: HandlerFn(c.ReportDatasetStats),
+		},
 		"/api/v1/train": {
-			POST: HandlerFn(c.StartTraining),
-			GET:  HandlerFn(c.ReportTrainingStatistics),
+			POST:   HandlerFn(c.StartTraining),
+			GET:    HandlerFn(c.ReportTrainingStatistics),
+			DELETE: HandlerFn(c.StopTraining),
+		},
+		"/api/v1/train/queue": {
+			GET: HandlerFn(c.ReportTrainingQueue),
+		},
+		"/api/v1/train/events": {
+			GET: HandlerFn(c.StreamTrainingEvents),
+		},
+		"/api/v1/train/sessions": {
+			GET: HandlerFn(c.ListTrainingSessions),
+		},
+		"/api/v1/train/sessions/{id}": {
+			GET: HandlerFn(c.ReportTrainingSession),
+		},
+		"/api/v1/train/sessions/{id}/resume": {
+			POST: HandlerFn(c.ResumeTraining),
+		},
+		"/api/v1/train/sessions/{id}/metrics": {
+			GET: HandlerFn(c.ReportTrainingMetrics),
+		},
+		"/api/v1/train/sessions/{id}/chart.{format:svg|png}": {
+			GET: HandlerFn(c.ReportTrainingChart),
 		},
 		"/api/v1/accuracy": {
 			GET:    HandlerFn(c.ReportAccuracyStatistics),
@@ -49,110 +120,92 @@ func (c *DarknetController) Routes() Routes {
 	}
 }
 
-func NewDarknetController(config *cfg.AppConfig) *DarknetController {
+func NewDarknetController(config *cfg.AppConfig, backend darknet.Backend) *DarknetController {
 	controller := &DarknetController{
-		AppConfig: config,
+		Backend:       backend,
+		AppConfig:     config,
+		datasetWriter: dataset.NewWriter(config),
 	}
+	controller.RegisterModel(DefaultModelName, cfg.ModelConfig{
+		Config:  config.ConfigFile,
+		Weights: config.WeightsFile,
+		Data:    config.DataFile,
+	})
 	controller.validationPool.Put(struct{}{})
 	return controller
 }
 
 func (c *DarknetController) Predict(ctx Context) Response {
-	if c.Network == nil {
-		c.Network = darknet.LoadNetwork(c.ConfigFile, c.DataFile, c.WeightsFile)
-	}
+	format, render := renderFormat(ctx.Request)
 
-	reader, err := ReadMultipart(ctx.Request)
-	if err != nil {
-		return BadRequest()
-	}
 	var response []PredictResponse
-	for {
-		part, err := reader.NextPart()
-		if err != nil {
-			if err == io.EOF {
-				break
+	var rendered *bytes.Buffer
+	resp := c.detectParts(ctx.Request, func(p *predictedImage) error {
+		if render {
+			if rendered != nil {
+				return errBadRequest("rendering only supports a single image per request")
 			}
-			return Error(err)
+			if format == "" {
+				format = encodableFormat(p.Format)
+			}
+			rendered = &bytes.Buffer{}
+			return darknetrender.Encode(rendered, darknetrender.Render(p.Image, p.Detections), format)
 		}
 
 		response = append(response, PredictResponse{
-			File:        part.FileName(),
-			Name:        part.FormName(),
-			ContentType: part.Header.Get("Content-Type"),
+			File:        p.Part.FileName(),
+			Name:        p.Part.FormName(),
+			ContentType: p.Part.Header.Get("Content-Type"),
+			Detections:  toDetections(p.Detections),
 		})
+		return nil
+	})
+	if resp != nil {
+		return resp
+	}
 
-		img, err := darknet.NewImageFromReader(part)
-		if err != nil {
-			return Error(err)
-		}
-
-		detections := c.Network.DetectImage(img)
-		_ = img.Close()
-
-		var rDetections []Detection
-		for _, detection := range detections {
-			rDetections = append(rDetections, Detection{
-				X1:         int(detection.X1),
-				Y1:         int(detection.Y1),
-				X2:         int(detection.X2),
-				Y2:         int(detection.Y2),
-				Class:      detection.Class,
-				ClassName:  detection.ClassName,
-				Confidence: detection.Confidence,
-			})
+	if render {
+		if rendered == nil {
+			return ErrorString(http.StatusBadRequest, "no image to render")
 		}
-		response[len(response)-1].Detections = rDetections
+		return Data(darknetrender.ContentType(format), rendered.Bytes())
 	}
-
 	return JSON(response)
 }
 
-func (c *DarknetController) getDatasetToUse() (func() string, error) {
-	dataFile, err := darknetcfg.ReadDataFile(c.DataFile)
-	if err != nil {
-		return nil, err
-	}
-	trainFile := dataFile.Get(darknetcfg.Train)
-	validFile := dataFile.Get(darknetcfg.Valid)
-
-	trainCount := countLines(trainFile)
-	validCount := countLines(validFile)
-	if validCount < 0 || trainCount < 0 {
-		return nil, fmt.Errorf("failed to count number of lines in train/valid")
-	}
-
-	return func() string {
-		if float64(trainCount)/float64(validCount)/100 < c.DatasetSplit {
-			validCount++
-			return validFile
-		}
-		trainCount++
-		return trainFile
-	}, nil
+// predictedImage is an image part of a predict request along with its detections
+type predictedImage struct {
+	Part       *multipart.Part
+	Image      image.Image
+	Format     string
+	Detections []*darknet.Detection
+	options    PredictOptions
 }
 
-func (c *DarknetController) Label(ctx Context) Response {
-	reader, err := ReadMultipart(ctx.Request)
+// detectParts runs detection on every image part of a multipart request and passes the results to fn in the order of
+// the parts. A part named "options" holds json PredictOptions which apply to all subsequent images. A nil response is
+// returned on success.
+func (c *DarknetController) detectParts(r *http.Request, fn func(p *predictedImage) error) Response {
+	model, err := c.acquireModel(modelName(r))
 	if err != nil {
-		return BadRequest()
+		if e, ok := err.(*statusError); ok {
+			return ErrorString(e.status, e.text)
+		}
+		return Error(err)
 	}
+	defer model.release()
 
-	err = os.MkdirAll(c.DatasetPath(), 0755)
+	opts, err := c.predictOptions(r)
 	if err != nil {
-		return Error(err)
+		return ErrorString(http.StatusBadRequest, err.Error())
 	}
 
-	datasetToUse, err := c.getDatasetToUse()
+	reader, err := ReadMultipart(r)
 	if err != nil {
-		return Error(err)
+		return BadRequest()
 	}
-
-	var imgBuf []byte
-	var img image.Image
-	var size image.Rectangle
-	var ext string
-	for i := 0; ; i++ {
+	var images []*predictedImage
+	for {
 		part, err := reader.NextPart()
 		if err != nil {
 			if err == io.EOF {
@@ -160,93 +213,165 @@ func (c *DarknetController) Label(ctx Context) Response {
 			}
 			return Error(err)
 		}
-		if i%2 == 0 {
-			//image
-			imgBuf, err = ioutil.ReadAll(part)
-			if err != nil {
-				return Error(err)
-			}
-			img, ext, err = image.Decode(bytes.NewBuffer(imgBuf))
-			if err != nil {
-				return Error(err)
+
+		if part.FormName() == predictOptionsFormName {
+			err = json.NewDecoder(part).Decode(&opts)
+			if err == nil {
+				err = opts.Validate()
 			}
-			size = img.Bounds()
-		} else {
-			//json
-			var labels []*Label
-			err := json.NewDecoder(part).Decode(&labels)
 			if err != nil {
-				return Error(err)
+				return ErrorString(http.StatusBadRequest, err.Error())
 			}
+			continue
+		}
 
-			imgMd5 := fmt.Sprintf("%x", md5.Sum(imgBuf))
-			imgDst := filepath.Join(c.DatasetPath(), imgMd5+"."+ext)
-			txtDst := filepath.Join(c.DatasetPath(), imgMd5+".txt")
-			err = ioutil.WriteFile(imgDst, imgBuf, 0644)
-			if err != nil {
-				return Error(err)
-			}
+		img, format, err := image.Decode(part)
+		if err != nil {
+			return Error(err)
+		}
 
-			dataset := datasetToUse()
-			outFile, err := os.OpenFile(dataset, os.O_RDWR, 0644)
-			if err != nil {
-				return Error(err)
-			}
-			fInfo, err := outFile.Stat()
-			if err != nil {
-				return Error(err)
-			}
-			if fInfo.Size() > 0 {
-				_, err = outFile.Seek(-1, io.SeekEnd)
-				if err != nil {
-					return Error(err)
-				}
-				nlbuf := []byte{0}
-				_, err = outFile.Read(nlbuf)
-				if err != nil {
-					return Error(err)
-				}
-				if string(nlbuf) != "\n" {
-					_, err = outFile.WriteString("\n")
-					if err != nil {
-						return Error(err)
-					}
-				}
-			}
-			relImgDst, err := filepath.Rel(filepath.Dir(c.DatasetPath()), imgDst)
-			if err != nil {
-				return Error(err)
-			}
-			_, err = outFile.WriteString(relImgDst)
-			if err != nil {
-				return Error(err)
-			}
-			_ = outFile.Close()
+		images = append(images, &predictedImage{
+			Part:    part,
+			Image:   img,
+			Format:  format,
+			options: opts,
+		})
+	}
 
-			var yoloLabels []string
-			for _, label := range labels {
-				yoloLabels = append(yoloLabels, label.Yolo(size))
-			}
+	//submit up to BatchSize images at once, letting the detector batch them together
+	errs := make([]error, len(images))
+	sem := make(chan struct{}, c.batchSize())
+	var wg sync.WaitGroup
+	for i, p := range images {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p *predictedImage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p.Detections, errs[i] = model.DetectCustom(p.Image, p.options.Thresh, p.options.HierThresh, p.options.NMS)
+		}(i, p)
+	}
+	wg.Wait()
 
-			err = ioutil.WriteFile(txtDst, []byte(strings.Join(yoloLabels, "\n")), 0644)
-			if err != nil {
-				return Error(err)
+	for _, err := range errs {
+		if err == darknet.ErrPoolBusy {
+			return ErrorString(http.StatusServiceUnavailable, err.Error(), WithHeader("Retry-After", c.retryAfter()))
+		}
+		if err != nil {
+			return Error(err)
+		}
+	}
+
+	for _, p := range images {
+		if err := fn(p); err != nil {
+			if e, ok := err.(*statusError); ok {
+				return ErrorString(e.status, e.text)
 			}
+			return Error(err)
 		}
 	}
-	return OK()
+	return nil
 }
 
-func (c *DarknetController) StartTraining(ctx Context) Response {
-	if c.IsTraining() {
-		return Status(http.StatusServiceUnavailable)
+// retryAfter returns the number of seconds clients should wait before retrying a rejected prediction
+func (c *DarknetController) retryAfter() string {
+	seconds := int(math.Ceil(c.PoolWait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
 	}
+	return strconv.Itoa(seconds)
+}
+
+func toDetections(detections []*darknet.Detection) []Detection {
+	var rDetections []Detection
+	for _, detection := range detections {
+		rDetections = append(rDetections, toDetection(detection))
+	}
+	return rDetections
+}
+
+func toDetection(detection *darknet.Detection) Detection {
+	return Detection{
+		X1:         int(detection.X1),
+		Y1:         int(detection.Y1),
+		X2:         int(detection.X2),
+		Y2:         int(detection.Y2),
+		Class:      detection.Class,
+		ClassName:  detection.ClassName,
+		Confidence: detection.Confidence,
+	}
+}
+
+// encodableFormat returns format if it can be encoded by darknetrender.Encode, otherwise jpeg
+func encodableFormat(format string) string {
+	if format != "png" {
+		return "jpeg"
+	}
+	return format
+}
 
+// renderFormat determines whether the predict response should be the input image annotated with the detections
+// rather than json, either by ?render=true or by an Accept header preferring an image. The returned format is empty
+// when the format of the input image should be kept.
+func renderFormat(r *http.Request) (format string, render bool) {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "image/png"):
+		format = "png"
+	case strings.Contains(accept, "image/jpeg"):
+		format = "jpeg"
+	}
+
+	if v := r.URL.Query().Get("render"); v != "" {
+		render, _ = strconv.ParseBool(v)
+		return format, render
+	}
+	return format, format != ""
+}
+
+// predictOptions returns the server default predict options overridden by any query parameters
+func (c *DarknetController) predictOptions(r *http.Request) (PredictOptions, error) {
+	opts := c.DefaultPredictOptions()
+	query := r.URL.Query()
+	for key, dst := range map[string]*float32{
+		"thresh":      &opts.Thresh,
+		"hier_thresh": &opts.HierThresh,
+		"nms":         &opts.NMS,
+	} {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s: %s", key, v)
+		}
+		*dst = float32(f)
+	}
+	return opts, opts.Validate()
+}
+
+// DefaultPredictOptions returns the predict options as configured for the server
+func (c *DarknetController) DefaultPredictOptions() PredictOptions {
+	return PredictOptions{
+		Thresh:     float32(c.Thresh),
+		HierThresh: float32(c.HierThresh),
+		NMS:        float32(c.NMS),
+	}
+}
+
+// StartTraining enqueues a training job, which is run once the jobs before it have finished
+func (c *DarknetController) StartTraining(ctx Context) Response {
 	data := &TrainingRequest{
-		Data:    c.DataFile,
-		Config:  c.ConfigFile,
-		Weights: c.WeightsFile,
-		Clear:   c.Clear,
+		Data:            c.DataFile,
+		Config:          c.ConfigFile,
+		Weights:         c.WeightsFile,
+		Clear:           c.Clear,
+		GPUs:            c.GPUs,
+		CalcMAP:         c.CalcMAP,
+		MJPEGPort:       c.MJPEGPort,
+		BenchmarkLayers: c.Benchmark,
+		NoAutoCfg:       c.NoAutoCfg,
 	}
 	if ctx.Request.ContentLength > 0 {
 		err := json.NewDecoder(ctx.Request.Body).Decode(data)
@@ -254,26 +379,17 @@ func (c *DarknetController) StartTraining(ctx Context) Response {
 			return BadRequest()
 		}
 	}
-
-	args := []string{"train", "--data", data.Data, "--config", data.Config, "--weights", data.Weights}
-	if data.Clear {
-		args = append(args, "--clear")
+	data.Resume = ""
+	for _, f := range []string{data.Data, data.Config} {
+		if _, err := os.Stat(f); err != nil {
+			return ErrorString(http.StatusBadRequest, err.Error())
+		}
 	}
-	cmd := exec.Command(os.Args[0], args...)
-	r, w := io.Pipe()
-	cmd.Stdout = w
-	cmd.Stderr = w
-	err := cmd.Start()
-	if err != nil {
-		return Error(err)
+	if err := data.trainOptions().Validate(); err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go c.readTrainingOutput(r, &wg)
-	wg.Wait() //wait until first iteration
-
-	return Redirect(ctx.Request.RequestURI, http.StatusSeeOther)
+	return c.enqueueTraining(*data)
 }
 
 func (c *DarknetController) ReportTrainingStatistics(_ Context) Response {
@@ -325,6 +441,7 @@ func (c *DarknetController) ClearAccuracyStatistics(_ Context) Response {
 		baseDir := filepath.Dir(filepath.Dir(weightFile))
 		args := []string{
 			"validate",
+			"--backend", c.BackendName,
 			"--data", filepath.Join(baseDir, "dataset.cfg"),
 			"--config", filepath.Join(baseDir, "network.cfg"),
 			"--weights", weightFile,
@@ -363,22 +480,16 @@ func (c *DarknetController) ReportAccuracyStatistics(_ Context) Response {
 	return JSONRaw(buf)
 }
 
-func countLines(filename string) int {
-	buf, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return -1
+// readTrainingOutput parses the output of the train command and returns the id of the session it trains
+func (c *DarknetController) readTrainingOutput(r io.Reader) (id string) {
+	err := os.MkdirAll(c.TrainingBasePath(), 0755)
+	var flh *os.File
+	if err == nil {
+		flh, err = os.Create(c.TrainingLogPath())
 	}
-
-	return bytes.Count(buf, []byte("\n"))
-}
-
-func (c *DarknetController) readTrainingOutput(r io.Reader, wg *sync.WaitGroup) {
-	var once sync.Once
-	defer once.Do(wg.Done)
-
-	flh, err := os.Create(c.TrainingLogPath())
 	if err != nil {
 		log.Println(err)
+		_, _ = io.Copy(ioutil.Discard, r)
 		return
 	}
 	defer flh.Close()
@@ -401,32 +512,43 @@ func (c *DarknetController) readTrainingOutput(r io.Reader, wg *sync.WaitGroup)
 		Target          string  `json:"target"`
 	}
 
-	var directoryCreated bool
+	sessionRe := regexp.MustCompile(`(?:creating a new training session @ (.+)|resuming training session (\S+) from)`)
+	weightsRe := regexp.MustCompile(`Saving weights to (.+)`)
+	var mAP *float64
+	var metrics *session.MetricsWriter
+	defer func() {
+		if metrics != nil {
+			metrics.Close()
+		}
+	}()
 	for scanner.Scan() {
 		func() {
 			line := strings.TrimSpace(scanner.Text())
-			if !directoryCreated && strings.HasPrefix(line, "creating a new training session") {
-				files, err := ioutil.ReadDir(c.TrainingBasePath())
-				if err != nil {
+			if id == "" && sessionRe.MatchString(line) {
+				matches := sessionRe.FindStringSubmatch(line)
+				id = filepath.Base(matches[1] + matches[2])
+				stats.Target = filepath.Join("train", id)
+				c.events.publish(EventSession, id, nil)
+				if metrics, err = session.OpenMetrics(c.TrainingSessionPath(id)); err != nil {
 					log.Println(err)
-					return
 				}
-				var path string
-				var max time.Time
-				for _, f := range files {
-					if max.After(f.ModTime()) {
-						continue
-					}
-					max = f.ModTime()
-					path = filepath.Join("train", f.Name())
-				}
-				stats.Target = path
 			}
 			if strings.HasPrefix(line, "Last accuracy mAP@") {
 				matches := mapRe.FindAllStringSubmatch(line, -1)
 				stats.MapIOUThreshold = tryToFloat(matches[0][1])
 				stats.MapLast = tryToFloat(matches[0][2]) / 100
 				stats.MapBest = tryToFloat(matches[0][3]) / 100
+				last := stats.MapLast
+				mAP = &last
+				c.events.publish(EventMAP, id, TrainingMAP{
+					Iteration:    stats.Iteration,
+					IOUThreshold: stats.MapIOUThreshold,
+					Last:         stats.MapLast,
+					Best:         stats.MapBest,
+				})
+			}
+			if matches := weightsRe.FindStringSubmatch(line); matches != nil {
+				c.events.publish(EventWeights, id, TrainingWeights{File: matches[1]})
 			}
 			if strings.HasSuffix(line, "hours left") {
 				fjh, err := os.Create(c.TrainingStatsPath())
@@ -435,7 +557,6 @@ func (c *DarknetController) readTrainingOutput(r io.Reader, wg *sync.WaitGroup)
 					return
 				}
 				defer fjh.Close()
-				defer once.Do(wg.Done)
 				matches := statsRe.FindAllStringSubmatch(line, -1)
 				encoder := json.NewEncoder(fjh)
 
@@ -446,6 +567,22 @@ func (c *DarknetController) readTrainingOutput(r io.Reader, wg *sync.WaitGroup)
 				stats.ElapsedSeconds = tryToFloat(matches[0][5])
 				stats.Images = tryToInt(matches[0][6])
 				stats.HoursLeft = tryToFloat(matches[0][7])
+				metric := &session.Metric{
+					Iteration: stats.Iteration,
+					Loss:      stats.Loss,
+					AvgLoss:   stats.AvgLoss,
+					Rate:      stats.CurrentRate,
+					Images:    stats.Images,
+					HoursLeft: stats.HoursLeft,
+					MAP:       mAP,
+					Time:      time.Now(),
+				}
+				c.events.publish(EventIteration, id, metric)
+				if metrics != nil {
+					if err := metrics.Write(metric); err != nil {
+						log.Println(err)
+					}
+				}
 
 				err = encoder.Encode(stats)
 				if err != nil {
@@ -460,6 +597,9 @@ func (c *DarknetController) readTrainingOutput(r io.Reader, wg *sync.WaitGroup)
 			}
 		}()
 	}
+	//keep the train command from blocking on its output should scanning stop early
+	_, _ = io.Copy(ioutil.Discard, r)
+	return
 }
 
 func (c *DarknetController) readValidationOutput(r io.Reader) Accuracy {
@@ -527,10 +667,79 @@ func (c *DarknetController) readValidationOutput(r io.Reader) Accuracy {
 }
 
 type TrainingRequest struct {
-	Data    string `json:"data"`
-	Config  string `json:"config"`
-	Weights string `json:"weights"`
-	Clear   bool   `json:"clear"`
+	Data            string `json:"data"`
+	Config          string `json:"config"`
+	Weights         string `json:"weights"`
+	Clear           bool   `json:"clear"`
+	Resume          string `json:"resume,omitempty"` //id of the session to resume, instead of training data and config
+	GPUs            []int  `json:"gpus,omitempty"`
+	CalcMAP         bool   `json:"calcMap"`
+	MJPEGPort       int    `json:"mjpegPort"`
+	BenchmarkLayers bool   `json:"benchmarkLayers"`
+	NoAutoCfg       bool   `json:"noAutoCfg"` //train with the config as is instead of adjusting it to the number of classes
+}
+
+// trainOptions returns the darknet training options of the request
+func (r TrainingRequest) trainOptions() *darknet.TrainOptions {
+	return darknet.NewTrainOptions(
+		darknet.WithGPUs(r.GPUs...),
+		darknet.WithCalcMAP(r.CalcMAP),
+		darknet.WithMJPEGPort(r.MJPEGPort),
+		darknet.WithBenchmarkLayers(r.BenchmarkLayers),
+	)
+}
+
+// args returns the arguments of the train command for the request
+func (r TrainingRequest) args() []string {
+	var args []string
+	if r.Resume != "" {
+		args = append(args, "--resume", r.Resume)
+	} else {
+		args = append(args, "--data", r.Data, "--config", r.Config)
+		if r.Weights != "" {
+			args = append(args, "--weights", r.Weights)
+		}
+	}
+	if r.Clear {
+		args = append(args, "--clear")
+	}
+	if r.Resume != "" {
+		//resumed sessions train with the options they were created with
+		return args
+	}
+	o := r.trainOptions()
+	for _, gpu := range o.GPUs {
+		args = append(args, "--gpus", strconv.Itoa(gpu))
+	}
+	args = append(args,
+		fmt.Sprintf("--calc-map=%t", o.CalcMAP),
+		"--mjpeg-port", strconv.Itoa(o.MJPEGPort),
+		fmt.Sprintf("--benchmark-layers=%t", o.BenchmarkLayers),
+		fmt.Sprintf("--no-auto-cfg=%t", r.NoAutoCfg),
+	)
+	return args
+}
+
+// predictOptionsFormName is the name of the optional multipart json part holding PredictOptions
+const predictOptionsFormName = "options"
+
+type PredictOptions struct {
+	Thresh     float32 `json:"thresh"`
+	HierThresh float32 `json:"hier_thresh"`
+	NMS        float32 `json:"nms"`
+}
+
+func (o PredictOptions) Validate() error {
+	for key, v := range map[string]float32{
+		"thresh":      o.Thresh,
+		"hier_thresh": o.HierThresh,
+		"nms":         o.NMS,
+	} {
+		if math.IsNaN(float64(v)) || v < 0 || v > 1 {
+			return fmt.Errorf("%s must be between 0.0 and 1.0, got %v", key, v)
+		}
+	}
+	return nil
 }
 
 type PredictResponse struct {
@@ -574,24 +783,3 @@ type ClassAccuracy struct {
 	TruePositives    int     `json:"tp"`
 	FalsePositives   int     `json:"fp"`
 }
-
-type Label struct {
-	X1    float64 `json:"x1"`
-	Y1    float64 `json:"y1"`
-	X2    float64 `json:"x2"`
-	Y2    float64 `json:"y2"`
-	Class int     `json:"class"`
-}
-
-//TODO handle multiple classes? [1, x_center, y_center, width, height, 1, 0, 1, 0, 0]
-func (l *Label) Yolo(size image.Rectangle) string {
-	w := (l.X2 - l.X1) / float64(size.Max.X)
-	h := (l.Y2 - l.Y1) / float64(size.Max.Y)
-	return fmt.Sprintf("%d %f %f %f %f",
-		l.Class,
-		l.X1/float64(size.Max.X)+w/2,
-		l.Y1/float64(size.Max.Y)+h/2,
-		w,
-		h,
-	)
-}
@@ -1,38 +1,961 @@
 package ctrl
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"github.com/netbrain/darknetw/cfg"
 	"github.com/netbrain/darknetw/ctrl/multipart"
 	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/fake"
+	"github.com/netbrain/darknetw/dataset"
+	"github.com/netbrain/darknetw/session"
 	"github.com/netbrain/darknetw/test"
 	"github.com/stretchr/testify/require"
 	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	gomultipart "mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDarknetController_Label(t *testing.T) {
 	config, cleanup := test.BootstrapTestEnvironment()
 	defer cleanup()
+	//the valid list takes the next image as a tenth of the images
+	var train []string
+	for i := 0; i < 9; i++ {
+		train = append(train, "")
+	}
+	writeTestDataset(t, config, train, nil)
 
 	labels, err := darknet.ParseLabelFile(image.Rect(0, 0, 416, 416), "testdata/0.txt")
 	require.NoError(t, err)
+	pngImage := &bytes.Buffer{}
+	require.NoError(t, png.Encode(pngImage, image.NewGray(image.Rect(0, 0, 100, 50))))
+	pngLabels := darknet.Labels{{X1: 10, Y1: 10, X2: 60, Y2: 30, Class: 0}}
 
-	ctrl := NewDarknetController(config)
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+	label := func(status int, options ...multipart.Option) []*LabelResult {
+		body := &bytes.Buffer{}
+		r := httptest.NewRequest("POST", "/api/v1/label", body)
+		require.NoError(t, multipart.WriteMultipart(r, body, options...))
+		response := Do(handler, r)
+		require.Equal(t, status, response.StatusCode)
+		buf, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		var results []*LabelResult
+		if bytes.HasPrefix(buf, []byte("[")) {
+			require.NoError(t, json.Unmarshal(buf, &results))
+		}
+		return results
+	}
+	lines := func(split string) []string {
+		buf, err := ioutil.ReadFile(filepath.Join(config.Storage, split+".txt"))
+		require.NoError(t, err)
+		return strings.Fields(string(buf))
+	}
+
+	//unindexed parts are paired in order
+	results := label(http.StatusOK,
+		multipart.WithFormFile("image", "testdata/0.jpeg"),
+		multipart.WithFormField("label", labels.JSON()),
+	)
+	require.Len(t, results, 1)
+	jpegID := fmt.Sprintf("%x", md5.Sum(testImage(t)))
+	require.Equal(t, &LabelResult{Index: 0, ID: jpegID, Split: "valid"}, results[0])
+	require.Equal(t, []string{"dataset/" + jpegID + ".jpeg"}, lines("valid"))
+	yolo, err := ioutil.ReadFile(filepath.Join(config.DatasetPath(), jpegID+".txt"))
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("testdata/0.txt")
+	require.NoError(t, err)
+	require.Equal(t, strings.TrimSpace(string(expected)), string(yolo))
+
+	//indexed parts are paired by index in any order, an image listed already keeps its split
+	results = label(http.StatusOK,
+		multipart.WithFormField("label[1]", pngLabels.JSON()),
+		multipart.WithFormFileFromReader("image[0]", "0.jpeg", bytes.NewReader(testImage(t))),
+		multipart.WithFormField("label[0]", []byte("[]")),
+		multipart.WithFormFileFromReader("image[1]", "1.png", bytes.NewReader(pngImage.Bytes())),
+	)
+	require.Len(t, results, 2)
+	pngID := fmt.Sprintf("%x", md5.Sum(pngImage.Bytes()))
+	require.Equal(t, &LabelResult{Index: 0, ID: pngID, Split: "train"}, results[0])
+	require.Equal(t, &LabelResult{Index: 1, ID: jpegID, Split: "valid"}, results[1])
+	require.Len(t, lines("train"), 10)
+	require.Equal(t, "dataset/"+pngID+".png", lines("train")[9])
+	require.Equal(t, []string{"dataset/" + jpegID + ".jpeg"}, lines("valid"))
+	yolo, err = ioutil.ReadFile(filepath.Join(config.DatasetPath(), pngID+".txt"))
+	require.NoError(t, err)
+	require.Equal(t, "0 0.350000 0.400000 0.500000 0.400000", string(yolo))
+	yolo, err = ioutil.ReadFile(filepath.Join(config.DatasetPath(), jpegID+".txt"))
+	require.NoError(t, err)
+	require.Empty(t, yolo)
+
+	//parts named otherwise are paired by position, each image followed by its labels
+	results = label(http.StatusOK,
+		multipart.WithFormFileFromReader("file", "0.jpeg", bytes.NewReader(testImage(t))),
+		multipart.WithFormField("json", labels.JSON()),
+	)
+	require.Equal(t, []*LabelResult{{Index: 0, ID: jpegID, Split: "valid"}}, results)
+	yolo, err = ioutil.ReadFile(filepath.Join(config.DatasetPath(), jpegID+".txt"))
+	require.NoError(t, err)
+	require.Equal(t, strings.TrimSpace(string(expected)), string(yolo))
+
+	//nothing is written unless every image is valid
+	results = label(http.StatusBadRequest,
+		multipart.WithFormFileFromReader("image[0]", "2.png", bytes.NewReader(pngImage.Bytes()[:20])),
+		multipart.WithFormField("label[0]", []byte("[]")),
+		multipart.WithFormFile("image[1]", "testdata/0.jpeg"),
+		multipart.WithFormField("label[1]", []byte("[]")),
+		multipart.WithFormFile("image[2]", "testdata/0.jpeg"),
+		multipart.WithFormField("label[2]", []byte("[]")),
+		multipart.WithFormFileFromReader("image[3]", "3.png", bytes.NewReader(pngImage.Bytes())),
+		multipart.WithFormField("label[3]", []byte(`[{"x1": 0, "y1": 0, "x2": 10, "y2": 10, "class": 2}]`)),
+	)
+	require.Len(t, results, 4)
+	for _, r := range results {
+		require.Empty(t, r.ID)
+	}
+	require.NotEmpty(t, results[0].Error)
+	require.Empty(t, results[1].Error)
+	require.Contains(t, results[2].Error, "duplicate of image 1")
+	require.Contains(t, results[3].Error, "invalid class")
+	require.Len(t, lines("train"), 10)
+
+	for _, options := range [][]multipart.Option{
+		{multipart.WithFormFile("image", "testdata/0.jpeg")},
+		{multipart.WithFormField("label[0]", []byte("[]"))},
+		{multipart.WithFormFile("file", "testdata/0.jpeg")},
+		{multipart.WithFormFile("image", "testdata/0.jpeg"), multipart.WithFormField("options", []byte("{}"))},
+		{multipart.WithFormFile("image", "testdata/0.jpeg"), multipart.WithFormField("label", []byte("{"))},
+		{},
+	} {
+		label(http.StatusBadRequest, options...)
+	}
+	require.Len(t, lines("train"), 10)
+}
+
+func TestDarknetController_LabelJSON(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	writeTestDataset(t, config, nil, nil)
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+	post := func(body string) *http.Response {
+		r := httptest.NewRequest("POST", "/api/v1/label", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return Do(handler, r)
+	}
+
+	uploads, err := json.Marshal([]*LabelUpload{
+		{Image: testImage(t), Labels: darknet.Labels{{X1: 10, Y1: 10, X2: 20, Y2: 20, Class: 1}}},
+	})
+	require.NoError(t, err)
+	require.Contains(t, string(uploads), `"image":"/9j/`, "images are base64 encoded")
+	response := post(string(uploads))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var results []*LabelResult
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+	require.Len(t, results, 1)
+	require.Equal(t, fmt.Sprintf("%x", md5.Sum(testImage(t))), results[0].ID)
+	require.FileExists(t, filepath.Join(config.DatasetPath(), results[0].ID+".jpeg"))
+
+	for _, body := range []string{`[]`, `[{"image": "aGVsbG8="}]`, `[{"image": "aGVsbG8=", "labels": [], "extra": 1}]`, `{}`} {
+		response := post(body)
+		require.Equal(t, http.StatusBadRequest, response.StatusCode, body)
+	}
+	response = post(`[{"image": "aGVsbG8=", "labels": []}]`)
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+	require.Contains(t, results[0].Error, "unknown format")
+}
+
+func TestDarknetController_Predict(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	ctrl := NewDarknetController(config, &fake.Backend{
+		Detections: [][]*darknet.Detection{
+			{
+				{
+					Label:      darknet.Label{X1: 10, Y1: 20, X2: 110, Y2: 220, Class: 1},
+					ClassName:  "rectangle",
+					Confidence: 0.75,
+				},
+			},
+		},
+	})
 
 	handler := CreateRouter(ctrl)
 	body := &bytes.Buffer{}
-	r := httptest.NewRequest("POST", "/api/v1/label", body)
-	err = multipart.WriteMultipart(
+	r := httptest.NewRequest("POST", "/api/v1/predict", body)
+	err := multipart.WriteMultipart(
 		r,
 		body,
 		multipart.WithFormFile("image", "testdata/0.jpeg"),
-		multipart.WithFormField("label", labels.JSON()),
 	)
 	require.NoError(t, err)
 
 	response := Do(handler, r)
 	require.Equal(t, http.StatusOK, response.StatusCode)
-	//TODO test that label has been created in the storage directory
+
+	var predictions []PredictResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&predictions))
+	require.Len(t, predictions, 1)
+	require.Equal(t, "0.jpeg", predictions[0].File)
+	require.Equal(t, []Detection{
+		{Class: 1, ClassName: "rectangle", Confidence: 0.75, X1: 10, Y1: 20, X2: 110, Y2: 220},
+	}, predictions[0].Detections)
+}
+
+func TestDarknetController_PredictThresholds(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	ctrl := NewDarknetController(config, &fake.Backend{
+		Detections: [][]*darknet.Detection{
+			{
+				{Label: darknet.Label{X2: 10, Y2: 10}, Confidence: 0.3},
+				{Label: darknet.Label{X2: 20, Y2: 20}, Confidence: 0.6},
+			},
+		},
+	})
+	handler := CreateRouter(ctrl)
+
+	for _, tc := range []struct {
+		name       string
+		query      string
+		options    []byte
+		status     int
+		detections int
+	}{
+		{name: "server defaults", status: http.StatusOK, detections: 1},
+		{name: "query", query: "?thresh=0.25&nms=0", status: http.StatusOK, detections: 2},
+		{name: "options part", options: []byte(`{"thresh":0.7}`), status: http.StatusOK, detections: 0},
+		{name: "invalid query", query: "?hier_thresh=1.5", status: http.StatusBadRequest},
+		{name: "malformed query", query: "?thresh=abc", status: http.StatusBadRequest},
+		{name: "nan query", query: "?thresh=NaN", status: http.StatusBadRequest},
+		{name: "infinite query", query: "?hier_thresh=Inf", status: http.StatusBadRequest},
+		{name: "invalid options part", options: []byte(`{"nms":-1}`), status: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []multipart.Option
+			if tc.options != nil {
+				opts = append(opts, multipart.WithFormField("options", tc.options))
+			}
+			opts = append(opts, multipart.WithFormFile("image", "testdata/0.jpeg"))
+
+			body := &bytes.Buffer{}
+			r := httptest.NewRequest("POST", "/api/v1/predict"+tc.query, body)
+			require.NoError(t, multipart.WriteMultipart(r, body, opts...))
+
+			response := Do(handler, r)
+			require.Equal(t, tc.status, response.StatusCode)
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var predictions []PredictResponse
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&predictions))
+			require.Len(t, predictions, 1)
+			require.Len(t, predictions[0].Detections, tc.detections)
+		})
+	}
+}
+
+func TestDarknetController_PredictRender(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	handler := CreateRouter(NewDarknetController(config, &fake.Backend{}))
+
+	for _, tc := range []struct {
+		name        string
+		query       string
+		accept      string
+		contentType string
+	}{
+		{name: "query keeps input format", query: "?render=true", contentType: "image/jpeg"},
+		{name: "accept png", accept: "image/png", contentType: "image/png"},
+		{name: "render disabled", query: "?render=false", accept: "image/png", contentType: "application/json"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			r := httptest.NewRequest("POST", "/api/v1/predict"+tc.query, body)
+			require.NoError(t, multipart.WriteMultipart(r, body, multipart.WithFormFile("image", "testdata/0.jpeg")))
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+
+			response := Do(handler, r)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			require.Equal(t, tc.contentType, response.Header.Get("Content-Type"))
+			if tc.contentType == "application/json" {
+				return
+			}
+			img, _, err := image.Decode(response.Body)
+			require.NoError(t, err)
+			require.Equal(t, image.Rect(0, 0, 416, 416), img.Bounds())
+		})
+	}
+}
+
+func TestDarknetController_PredictCrops(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	handler := CreateRouter(NewDarknetController(config, &fake.Backend{
+		Detections: [][]*darknet.Detection{
+			{
+				{Label: darknet.Label{X1: 10, Y1: 20, X2: 110, Y2: 220, Class: 1}, Confidence: 0.9},
+				{Label: darknet.Label{X1: 400, Y1: 400, X2: 405, Y2: 405}, Confidence: 0.9},
+			},
+		},
+	}))
+
+	readCrops := func(t *testing.T, response *http.Response) ([]CropResponse, map[string][]byte) {
+		files := map[string][]byte{}
+		if response.Header.Get("Content-Type") == "application/zip" {
+			buf, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+			require.NoError(t, err)
+			for _, f := range zr.File {
+				fh, err := f.Open()
+				require.NoError(t, err)
+				files[f.Name], err = ioutil.ReadAll(fh)
+				require.NoError(t, err)
+			}
+		} else {
+			_, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			mr := gomultipart.NewReader(response.Body, params["boundary"])
+			for {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				files[part.FileName()], err = ioutil.ReadAll(part)
+				require.NoError(t, err)
+			}
+		}
+		var manifest []CropResponse
+		require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+		return manifest, files
+	}
+
+	for _, accept := range []string{"", "application/zip"} {
+		t.Run(accept, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			r := httptest.NewRequest("POST", "/api/v1/predict/crops?padding=15&min_size=10&format=png", body)
+			require.NoError(t, multipart.WriteMultipart(r, body, multipart.WithFormFile("image", "testdata/0.jpeg")))
+			r.Header.Set("Accept", accept)
+
+			response := Do(handler, r)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+
+			manifest, files := readCrops(t, response)
+			require.Len(t, manifest, 1)
+			require.Len(t, manifest[0].Crops, 1, "small detection is skipped")
+			crop := manifest[0].Crops[0]
+			require.Equal(t, "0_0.png", crop.File)
+			require.Equal(t, 1, crop.Detection.Class)
+			require.Equal(t, []int{0, 5, 125, 235}, []int{crop.X1, crop.Y1, crop.X2, crop.Y2})
+
+			img, format, err := image.Decode(bytes.NewReader(files[crop.File]))
+			require.NoError(t, err)
+			require.Equal(t, "png", format)
+			require.Equal(t, 125, img.Bounds().Dx())
+			require.Equal(t, 230, img.Bounds().Dy())
+		})
+	}
+
+	body := &bytes.Buffer{}
+	r := httptest.NewRequest("POST", "/api/v1/predict/crops?padding=-1", body)
+	require.NoError(t, multipart.WriteMultipart(r, body, multipart.WithFormFile("image", "testdata/0.jpeg")))
+	require.Equal(t, http.StatusBadRequest, Do(handler, r).StatusCode)
+}
+
+func TestDarknetController_PredictBatch(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	config.BatchSize = 3
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	detector := &fake.Detector{Options: darknet.NewDetectorOptions(darknet.WithBatchSize(3))}
+	ctrl.SwapModel(DefaultModelName, &Model{Detector: darknet.NewBatcher(detector, 3, time.Second)})
+	handler := CreateRouter(ctrl)
+
+	body := &bytes.Buffer{}
+	r := httptest.NewRequest("POST", "/api/v1/predict", body)
+	var opts []multipart.Option
+	for _, name := range []string{"a", "b", "c"} {
+		opts = append(opts, multipart.WithFormFileFromReader(name, name+".jpeg", bytes.NewReader(testImage(t))))
+	}
+	require.NoError(t, multipart.WriteMultipart(r, body, opts...))
+
+	response := Do(handler, r)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var predictions []PredictResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&predictions))
+	require.Len(t, predictions, 3)
+	for i, name := range []string{"a", "b", "c"} {
+		require.Equal(t, name, predictions[i].Name)
+		require.Len(t, predictions[i].Detections, 1)
+	}
+	require.Equal(t, []int{3}, detector.Batches)
+}
+
+func TestDarknetController_ReloadModel(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	old := &fake.Detector{}
+	ctrl.SwapModel(DefaultModelName, &Model{
+		Detector:    old,
+		ConfigFile:  config.ConfigFile,
+		WeightsFile: config.WeightsFile,
+		DataFile:    config.DataFile,
+	})
+	handler := CreateRouter(ctrl)
+
+	r := httptest.NewRequest("PUT", "/api/v1/model", bytes.NewBufferString(`{"weights":"missing.weights"}`))
+	require.Equal(t, http.StatusBadRequest, Do(handler, r).StatusCode)
+
+	weights := filepath.Join(filepath.Dir(config.WeightsFile), "network_new.weights")
+	require.NoError(t, ioutil.WriteFile(weights, []byte("new weights"), 0644))
+	body, err := json.Marshal(&ModelRequest{Weights: weights})
+	require.NoError(t, err)
+	r = httptest.NewRequest("PUT", "/api/v1/model", bytes.NewReader(body))
+	require.Equal(t, http.StatusAccepted, Do(handler, r).StatusCode)
+
+	var model ModelResponse
+	require.Eventually(t, func() bool {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/model", nil))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&model))
+		return model.Reload.Status != ModelReloadLoading
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, ModelReloadDone, model.Reload.Status)
+	require.Equal(t, weights, model.Weights)
+	require.Equal(t, config.ConfigFile, model.Config)
+	require.Eventually(t, old.Closed, time.Second, 10*time.Millisecond)
+
+	predictBody := &bytes.Buffer{}
+	r = httptest.NewRequest("POST", "/api/v1/predict", predictBody)
+	require.NoError(t, multipart.WriteMultipart(r, predictBody, multipart.WithFormFile("image", "testdata/0.jpeg")))
+	require.Equal(t, http.StatusOK, Do(handler, r).StatusCode)
+}
+
+func TestDarknetController_WatchModels(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+	body := &bytes.Buffer{}
+	r := httptest.NewRequest("POST", "/api/v1/predict", body)
+	require.NoError(t, multipart.WriteMultipart(r, body, multipart.WithFormFile("image", "testdata/0.jpeg")))
+	require.Equal(t, http.StatusOK, Do(handler, r).StatusCode)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go ctrl.WatchModels(10*time.Millisecond, stop)
+	reload := func() *ModelReload {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/model", nil))
+		var model ModelResponse
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&model))
+		return model.Reload
+	}
+
+	//a data file naming a missing names file fails to load, and is not retried until it changes again
+	data, err := ioutil.ReadFile(config.DataFile)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, ioutil.WriteFile(config.DataFile, []byte("classes = 2\nnames = missing.txt"), 0644))
+	require.Eventually(t, func() bool {
+		r := reload()
+		return r != nil && r.Status == ModelReloadFailed
+	}, time.Second, 10*time.Millisecond)
+	failed := reload()
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, failed.StartedAt, reload().StartedAt)
+
+	require.NoError(t, ioutil.WriteFile(config.DataFile, data, 0644))
+	require.Eventually(t, func() bool {
+		return reload().Status == ModelReloadDone
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDarknetController_Models(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	weights, err := os.Stat(config.WeightsFile)
+	require.NoError(t, err)
+	config.ModelsMemory = weights.Size() + 1 //room for a single model
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	ctrl.RegisterModel("second", cfg.ModelConfig{
+		Config:  config.ConfigFile,
+		Weights: config.WeightsFile,
+		Data:    config.DataFile,
+	})
+	handler := CreateRouter(ctrl)
+
+	predict := func(path string) *http.Response {
+		body := &bytes.Buffer{}
+		r := httptest.NewRequest("POST", path, body)
+		require.NoError(t, multipart.WriteMultipart(r, body, multipart.WithFormFile("image", "testdata/0.jpeg")))
+		return Do(handler, r)
+	}
+	loaded := func() map[string]bool {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/models", nil))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		var models []ModelResponse
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&models))
+		out := map[string]bool{}
+		for _, m := range models {
+			out[m.Name] = m.Loaded
+		}
+		return out
+	}
+
+	require.Equal(t, map[string]bool{DefaultModelName: false, "second": false}, loaded())
+	require.Equal(t, http.StatusOK, predict("/api/v1/predict").StatusCode)
+	require.Equal(t, map[string]bool{DefaultModelName: true, "second": false}, loaded())
+	require.Equal(t, http.StatusOK, predict("/api/v1/models/second/predict").StatusCode)
+	require.Equal(t, map[string]bool{DefaultModelName: false, "second": true}, loaded())
+	require.Equal(t, http.StatusNotFound, predict("/api/v1/models/missing/predict").StatusCode)
+
+	response := Do(handler, httptest.NewRequest("GET", "/api/v1/models/second", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var model ModelResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&model))
+	require.Equal(t, "second", model.Name)
+	require.Equal(t, weights.Size(), model.Size)
+}
+
+func TestDarknetController_TrainingSessions(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	for i, id := range []string{"first", "second"} {
+		s := &session.Session{
+			Dir:     config.TrainingSessionPath(id),
+			Status:  session.Running,
+			Started: time.Now().Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, os.MkdirAll(s.Dir, 0755))
+		require.NoError(t, s.Save())
+	}
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+
+	response := Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var sessions []*session.Session
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&sessions))
+	require.Len(t, sessions, 2)
+	require.Equal(t, "first", sessions[0].ID)
+	require.Equal(t, "second", sessions[1].ID)
+	for _, s := range sessions {
+		require.Equal(t, session.Interrupted, s.Status)
+	}
+
+	response = Do(handler, httptest.NewRequest("DELETE", "/api/v1/train", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	//the latest running session is still training while the lock is held
+	lock := config.LockTraining()
+	ok, err := lock.TryLock()
+	require.NoError(t, err)
+	require.True(t, ok)
+	defer lock.Unlock()
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/second", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var s session.Session
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&s))
+	require.Equal(t, "second", s.ID)
+	require.Equal(t, session.Running, s.Status)
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/missing", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = Do(handler, httptest.NewRequest("POST", "/api/v1/train/sessions/missing/resume", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+	//resuming is queued while training is running
+	response = Do(handler, httptest.NewRequest("POST", "/api/v1/train/sessions/first/resume", nil))
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	var job QueuedTrainingJob
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+	require.Equal(t, "first", job.Request.Resume)
+	require.Equal(t, JobQueued, job.Status)
+	//only interrupted or cancelled sessions can be resumed
+	response = Do(handler, httptest.NewRequest("POST", "/api/v1/train/sessions/second/resume", nil))
+	require.Equal(t, http.StatusConflict, response.StatusCode)
+	completed, err := session.Read(config.TrainingSessionPath("first"))
+	require.NoError(t, err)
+	require.NoError(t, completed.Finish(nil))
+	response = Do(handler, httptest.NewRequest("POST", "/api/v1/train/sessions/first/resume", nil))
+	require.Equal(t, http.StatusConflict, response.StatusCode)
+}
+
+func TestDarknetController_TrainingQueue(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+
+	for i := 1; i <= 2; i++ {
+		response := Do(handler, httptest.NewRequest("POST", "/api/v1/train", nil))
+		require.Equal(t, http.StatusAccepted, response.StatusCode)
+		require.Equal(t, "/api/v1/train/queue", response.Header.Get("Location"))
+		var job QueuedTrainingJob
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+		require.Equal(t, i, job.ID)
+		require.Equal(t, i, job.Position)
+		require.Equal(t, config.DataFile, job.Request.Data)
+	}
+
+	for _, body := range []string{`{"data":"missing.cfg"}`, `{"gpus":[0,0]}`, `{"mjpegPort":70000}`} {
+		response := Do(handler, httptest.NewRequest("POST", "/api/v1/train", strings.NewReader(body)))
+		require.Equal(t, http.StatusBadRequest, response.StatusCode, body)
+	}
+	response := Do(handler, httptest.NewRequest("POST", "/api/v1/train", strings.NewReader(`{"gpus":[1,2],"calcMap":false}`)))
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+	var job QueuedTrainingJob
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+	require.Equal(t, []string{
+		"--data", config.DataFile, "--config", config.ConfigFile, "--weights", config.WeightsFile,
+		"--gpus", "1", "--gpus", "2", "--calc-map=false", "--mjpeg-port", "0", "--benchmark-layers=false", "--no-auto-cfg=false",
+	}, job.Request.args())
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/train/queue", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var jobs []*QueuedTrainingJob
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&jobs))
+	require.Len(t, jobs, 3)
+	for i, job := range jobs {
+		require.Equal(t, JobQueued, job.Status)
+		require.Equal(t, i+1, job.Position)
+	}
+
+	//the queue survives a restart
+	queue, err := OpenTrainingQueue(config.TrainingQueuePath())
+	require.NoError(t, err)
+	require.Len(t, queue.Jobs(), 3)
+}
+
+func TestDarknetController_TrainingEvents(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	srv := httptest.NewServer(CreateRouter(ctrl))
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL + "/api/v1/train/events")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	dir := config.TrainingSessionPath("01012020_000000")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	id := ctrl.readTrainingOutput(strings.NewReader(strings.Join([]string{
+		"2020/01/01 00:00:00 creating a new training session @ " + dir,
+		" 1: 2.500000, 2.500000 avg loss, 0.001000 rate, 1.000000 seconds, 64 images, 10.000000 hours left",
+		" Last accuracy mAP@0.50 = 42.00 %, best = 42.00 % ",
+		" 2: 2.000000, 2.450000 avg loss, 0.001000 rate, 1.000000 seconds, 128 images, 9.000000 hours left",
+		"Saving weights to weights/network_last.weights",
+	}, "\n")))
+	require.Equal(t, "01012020_000000", id)
+
+	metrics, err := session.ReadMetrics(dir)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	require.Nil(t, metrics[0].MAP)
+	require.Equal(t, 0.42, *metrics[1].MAP)
+
+	scanner := bufio.NewScanner(response.Body)
+	var events []TrainingEvent
+	var types []string
+	for len(events) < 5 && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			types = append(types, strings.TrimPrefix(line, "event: "))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event TrainingEvent
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			require.Equal(t, id, event.Session)
+			events = append(events, event)
+		}
+	}
+	require.Equal(t, []string{EventSession, EventIteration, EventMAP, EventIteration, EventWeights}, types)
+
+	iteration := events[3].Data.(map[string]interface{})
+	require.Equal(t, 2.0, iteration["iteration"])
+	require.Equal(t, 2.45, iteration["avgLoss"])
+	require.Equal(t, 128.0, iteration["images"])
+	require.Equal(t, 0.42, iteration["mAP"])
+	require.Equal(t, "weights/network_last.weights", events[4].Data.(map[string]interface{})["file"])
+}
+
+func TestDarknetController_TrainingMetrics(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+
+	dir := config.TrainingSessionPath("trained")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, (&session.Session{Dir: dir, Status: session.Completed, Started: time.Now()}).Save())
+	w, err := session.OpenMetrics(dir)
+	require.NoError(t, err)
+	mAPs := []float64{0.2, 0.4}
+	for i := 1; i <= 10; i++ {
+		m := &session.Metric{Iteration: i, Loss: float64(i), AvgLoss: float64(i) / 2}
+		if i >= 4 {
+			m.MAP = &mAPs[0]
+		}
+		if i >= 8 {
+			m.MAP = &mAPs[1]
+		}
+		require.NoError(t, w.Write(m))
+	}
+	require.NoError(t, w.Close())
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+
+	metrics := func(query string) *TrainingMetrics {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/trained/metrics"+query, nil))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		tm := &TrainingMetrics{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(tm))
+		return tm
+	}
+	iterations := func(points []*LossPoint) []int {
+		var its []int
+		for _, p := range points {
+			its = append(its, p.Iteration)
+		}
+		return its
+	}
+
+	tm := metrics("")
+	require.Equal(t, "trained", tm.Session)
+	require.Len(t, tm.Loss, 10)
+	require.Equal(t, 2.5, tm.Loss[4].AvgLoss)
+	require.Len(t, tm.MAP, 2)
+	require.Equal(t, 4, tm.MAP[0].Iteration)
+	require.Equal(t, 0.4, tm.MAP[1].MAP)
+
+	tm = metrics("?every=4")
+	require.Equal(t, []int{3, 7, 10}, iterations(tm.Loss))
+
+	tm = metrics("?from=5&to=9&every=2")
+	require.Equal(t, []int{5, 7, 9}, iterations(tm.Loss))
+	require.Len(t, tm.MAP, 1)
+	require.Equal(t, 8, tm.MAP[0].Iteration)
+
+	for _, query := range []string{"?every=0", "?from=-1", "?to=abc"} {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/trained/metrics"+query, nil))
+		require.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+	response := Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/missing/metrics", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/trained/chart.svg", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "image/svg+xml", response.Header.Get("Content-Type"))
+	svg, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(svg), "training session trained")
+	require.Contains(t, string(svg), "learning rate")
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/trained/chart.png?every=2", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "image/png", response.Header.Get("Content-Type"))
+	img, format, err := image.Decode(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, "png", format)
+	require.Equal(t, 800, img.Bounds().Dx())
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/train/sessions/trained/chart.gif", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestDarknetController_Anchors(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	writeTestDataset(t, config,
+		[]string{"0 0.5 0.5 0.1 0.1\n1 0.5 0.5 0.5 0.25", "0 0.5 0.5 0.11 0.09", "1 0.5 0.5 0.5 0.26"},
+		[]string{"0 0.5 0.5 0.9 0.9"},
+	)
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+
+	response := Do(handler, httptest.NewRequest("GET", "/api/v1/dataset/anchors?n=2&width=100&height=200", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	r := &dataset.AnchorReport{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(r))
+	require.Equal(t, 4, r.Boxes)
+	require.Equal(t, "11,19, 50,51", r.Value)
+	require.True(t, r.AvgIoU > 0.9)
+
+	for query, status := range map[string]int{"?n=0": http.StatusBadRequest, "?n=5": http.StatusBadRequest, "?n=1000000000": http.StatusBadRequest, "?width=x": http.StatusBadRequest} {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/dataset/anchors"+query, nil))
+		require.Equal(t, status, response.StatusCode, query)
+	}
+}
+
+func TestDarknetController_DatasetStats(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	writeTestDataset(t, config,
+		[]string{"0 0.5 0.5 0.1 0.1\n1 0.5 0.5 0.5 0.25", ""},
+		[]string{"1 0.5 0.5 0.9 0.9"},
+	)
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+
+	response := Do(handler, httptest.NewRequest("GET", "/api/v1/dataset/stats", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	s := &dataset.Stats{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(s))
+	require.Equal(t, 416, s.Width)
+	require.Equal(t, 2, s.Splits["train"].Images)
+	require.Equal(t, []string{"dataset/train1.jpeg"}, s.Splits["train"].Unlabelled)
+	require.Equal(t, 1, s.Splits["valid"].Boxes)
+	require.Len(t, s.Classes, 2)
+	require.Equal(t, "rectangle", s.Classes[1].Name)
+	require.Equal(t, 0.5, s.Classes[1].ValidShare)
+
+	response = Do(handler, httptest.NewRequest("GET", "/api/v1/dataset/stats?width=0", nil))
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestDarknetController_Labels(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	writeTestDataset(t, config,
+		[]string{"0 0.5 0.5 0.25 0.5\n1 0.5 0.5 0.5 0.25", "0 0.5 0.5 0.1 0.1"},
+		[]string{"1 0.5 0.5 0.9 0.9"},
+	)
+
+	ctrl := NewDarknetController(config, &fake.Backend{})
+	handler := CreateRouter(ctrl)
+
+	list := func(query string) *LabelledImages {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/labels"+query, nil))
+		require.Equal(t, http.StatusOK, response.StatusCode, query)
+		page := &LabelledImages{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(page))
+		return page
+	}
+	ids := func(page *LabelledImages) []string {
+		var ids []string
+		for _, item := range page.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	page := list("")
+	require.Equal(t, 3, page.Total)
+	require.Equal(t, []string{"train0", "train1", "valid0"}, ids(page))
+	require.Equal(t, &LabelledImageItem{
+		ID:      "train0",
+		Split:   "train",
+		Path:    "dataset/train0.jpeg",
+		Image:   "/api/v1/labels/train0/image",
+		Boxes:   2,
+		Classes: []int{0, 1},
+	}, page.Items[0])
+	require.Equal(t, []string{"valid0"}, ids(list("?split=valid")))
+	require.Equal(t, []string{"train0", "valid0"}, ids(list("?class=1")))
+	page = list("?offset=1&limit=1")
+	require.Equal(t, 3, page.Total)
+	require.Equal(t, []string{"train1"}, ids(page))
+	for _, query := range []string{"?split=test", "?limit=0", "?class=-1"} {
+		response := Do(handler, httptest.NewRequest("GET", "/api/v1/labels"+query, nil))
+		require.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+
+	response := Do(handler, httptest.NewRequest("GET", "/api/v1/labels/train0", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	labelled := &LabelledImage{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(labelled))
+	require.Equal(t, "train", labelled.Split)
+	require.Len(t, labelled.Labels, 2)
+	w, h := float64(labelled.Width), float64(labelled.Height)
+	require.Equal(t, darknet.Label{X1: w * 0.375, X2: w * 0.625, Y1: h * 0.25, Y2: h * 0.75}, *labelled.Labels[0])
+
+	response = Do(handler, httptest.NewRequest("GET", labelled.Image, nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "image/jpeg", response.Header.Get("Content-Type"))
+
+	response = Do(handler, httptest.NewRequest("PUT", "/api/v1/labels/train1", strings.NewReader(fmt.Sprintf(`[{"x1": 0, "y1": 0, "x2": %g, "y2": %g, "class": 1}]`, w/2, h/4))))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	yolo, err := ioutil.ReadFile(filepath.Join(config.DatasetPath(), "train1.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "1 0.250000 0.125000 0.500000 0.250000", string(yolo))
+	for _, body := range []string{`[{"x1": 0, "y1": 0, "x2": 10000, "y2": 10, "class": 1}]`, `[{"x1": 0, "y1": 0, "x2": 10, "y2": 10, "class": 2}]`, `{}`} {
+		response = Do(handler, httptest.NewRequest("PUT", "/api/v1/labels/train1", strings.NewReader(body)))
+		require.Equal(t, http.StatusBadRequest, response.StatusCode, body)
+	}
+
+	response = Do(handler, httptest.NewRequest("DELETE", "/api/v1/labels/train0", nil))
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Equal(t, []string{"train1", "valid0"}, ids(list("")))
+	_, err = os.Stat(filepath.Join(config.DatasetPath(), "train0.jpeg"))
+	require.True(t, os.IsNotExist(err))
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		response = Do(handler, httptest.NewRequest(method, "/api/v1/labels/train0", strings.NewReader("[]")))
+		require.Equal(t, http.StatusNotFound, response.StatusCode, method)
+	}
+}
+
+// writeTestDataset lists a copy of the test image for each label in the train and valid lists, like the label endpoint
+// stores them
+func writeTestDataset(t *testing.T, config *cfg.AppConfig, train, valid []string) {
+	require.NoError(t, os.MkdirAll(config.DatasetPath(), 0755))
+	for split, labels := range map[string][]string{"train": train, "valid": valid} {
+		var list []string
+		for i, l := range labels {
+			name := fmt.Sprintf("%s%d", split, i)
+			require.NoError(t, ioutil.WriteFile(filepath.Join(config.DatasetPath(), name+".jpeg"), testImage(t), 0644))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(config.DatasetPath(), name+".txt"), []byte(l), 0644))
+			list = append(list, "dataset/"+name+".jpeg")
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(config.Storage, split+".txt"), []byte(strings.Join(list, "\n")+"\n"), 0644))
+	}
+}
+
+func testImage(t *testing.T) []byte {
+	buf, err := ioutil.ReadFile("testdata/0.jpeg")
+	require.NoError(t, err)
+	return buf
 }
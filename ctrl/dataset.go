@@ -0,0 +1,69 @@
+package ctrl
+
+import (
+	"errors"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/netbrain/darknetw/dataset"
+	"net/http"
+)
+
+// ReportAnchors calculates anchors from the labelled boxes of the train list. The n, width and height query parameters
+// default to the number of anchors and input size of the network config. At most dataset.MaxAnchors anchors, and no
+// more than the labelled boxes, are calculated.
+func (c *DarknetController) ReportAnchors(ctx Context) Response {
+	var n, width, height int
+	err := parseIntParams(ctx.Request.URL.Query(), intParam{"n", &n, 1}, intParam{"width", &width, 1}, intParam{"height", &height, 1})
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+
+	network, err := darknetcfg.ReadNetworkFile(c.ConfigFile)
+	if err != nil {
+		return Error(err)
+	}
+	n, width, height, err = dataset.AnchorDefaults(network, n, width, height)
+	if err != nil {
+		return Error(err)
+	}
+	data, err := darknetcfg.ReadDataFile(c.DataFile)
+	if err != nil {
+		return Error(err)
+	}
+	r, err := dataset.CalcAnchors(data, c.Storage, n, width, height)
+	if errors.Is(err, dataset.ErrTooFewBoxes) || errors.Is(err, dataset.ErrTooManyAnchors) {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return Error(err)
+	}
+	return JSON(r)
+}
+
+// ReportDatasetStats reports the images, class instances and box sizes of the train and valid lists. The box sizes are
+// relative to the width and height query parameters, which default to the input size of the network config.
+func (c *DarknetController) ReportDatasetStats(ctx Context) Response {
+	var width, height int
+	err := parseIntParams(ctx.Request.URL.Query(), intParam{"width", &width, 1}, intParam{"height", &height, 1})
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+
+	network, err := darknetcfg.ReadNetworkFile(c.ConfigFile)
+	if err != nil {
+		return Error(err)
+	}
+	width, height, err = dataset.InputSize(network, width, height)
+	if err != nil {
+		return Error(err)
+	}
+	data, err := darknetcfg.ReadDataFile(c.DataFile)
+	if err != nil {
+		return Error(err)
+	}
+	s, err := dataset.CalcStats(data, c.Storage, width, height)
+	if err != nil {
+		return Error(err)
+	}
+	return JSON(s)
+}
@@ -0,0 +1,125 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/netbrain/darknetw/api"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	EventSession   = "session"   //a training session started or resumed
+	EventIteration = "iteration" //a training iteration finished, see session.Metric
+	EventMAP       = "map"       //mAP was calculated
+	EventWeights   = "weights"   //a weights file was saved
+	EventFinished  = "finished"  //a training job completed, failed or was cancelled
+)
+
+// eventBuffer is the number of events buffered for each subscriber, events are dropped for subscribers falling behind
+const eventBuffer = 64
+
+// TrainingEvent is an event of the training events stream
+type TrainingEvent struct {
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	Session string      `json:"session,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// TrainingMAP is an mAP checkpoint
+type TrainingMAP struct {
+	Iteration    int     `json:"iteration"`
+	IOUThreshold float64 `json:"iouThreshold"`
+	Last         float64 `json:"last"`
+	Best         float64 `json:"best"`
+}
+
+// TrainingWeights is a weights file saved by a training session
+type TrainingWeights struct {
+	File string `json:"file"` //relative to the session directory
+}
+
+// trainingEvents fans out training events to the subscribed event streams
+type trainingEvents struct {
+	mu          sync.Mutex
+	subscribers map[chan TrainingEvent]struct{}
+}
+
+func (e *trainingEvents) subscribe() chan TrainingEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subscribers == nil {
+		e.subscribers = make(map[chan TrainingEvent]struct{})
+	}
+	ch := make(chan TrainingEvent, eventBuffer)
+	e.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (e *trainingEvents) unsubscribe(ch chan TrainingEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subscribers, ch)
+}
+
+func (e *trainingEvents) publish(typ, session string, data interface{}) {
+	event := TrainingEvent{
+		Type:    typ,
+		Time:    time.Now(),
+		Session: session,
+		Data:    data,
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// StreamTrainingEvents streams the training events as server-sent events until the client disconnects
+func (c *DarknetController) StreamTrainingEvents(ctx Context) Response {
+	flusher, ok := ctx.Response.(http.Flusher)
+	if !ok {
+		return ErrorString(http.StatusInternalServerError, "streaming is not supported")
+	}
+
+	events := c.events.subscribe()
+	defer c.events.unsubscribe(events)
+
+	w := ctx.Response
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	const keepAlive = 15 * time.Second
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return OK()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return OK()
+			}
+		case event := <-events:
+			buf, err := json.Marshal(event)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, buf); err != nil {
+				return OK()
+			}
+		}
+		flusher.Flush()
+	}
+}
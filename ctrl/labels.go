@@ -0,0 +1,488 @@
+package ctrl
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/netbrain/darknetw/dataset"
+	"image"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+const (
+	defaultLabelsLimit = 100
+	maxLabelsLimit     = 1000
+)
+
+// LabelledImages are a page of the images listed in the train and valid lists
+type LabelledImages struct {
+	Total  int                  `json:"total"` //number of images matching the filters
+	Offset int                  `json:"offset"`
+	Limit  int                  `json:"limit"`
+	Items  []*LabelledImageItem `json:"items"`
+}
+
+type LabelledImageItem struct {
+	ID      string `json:"id"`
+	Split   string `json:"split"`
+	Path    string `json:"path"`  //path as listed in the train or valid list
+	Image   string `json:"image"` //url of the image
+	Boxes   int    `json:"boxes"`
+	Classes []int  `json:"classes"` //distinct classes of the boxes
+}
+
+// LabelledImage is an image listed in the train or valid list along with its labels in pixels
+type LabelledImage struct {
+	ID     string         `json:"id"`
+	Split  string         `json:"split"`
+	Path   string         `json:"path"`
+	Image  string         `json:"image"`
+	Width  int            `json:"width"`
+	Height int            `json:"height"`
+	Labels darknet.Labels `json:"labels"`
+}
+
+func labelImageURL(id string) string {
+	return fmt.Sprintf("/api/v1/labels/%s/image", id)
+}
+
+// ListLabels reports the images of the train and valid lists in the order they are listed. The split and class query
+// parameters keep the images of a list and the images with a box of a class, offset and limit select a page.
+func (c *DarknetController) ListLabels(ctx Context) Response {
+	query := ctx.Request.URL.Query()
+	offset, limit, class := 0, defaultLabelsLimit, -1
+	err := parseIntParams(query, intParam{"offset", &offset, 0}, intParam{"limit", &limit, 1}, intParam{"class", &class, 0})
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+	if limit > maxLabelsLimit {
+		limit = maxLabelsLimit
+	}
+	split := darknetcfg.DarknetDataKey(query.Get("split"))
+	if split != "" && split != darknetcfg.Train && split != darknetcfg.Valid {
+		return ErrorString(http.StatusBadRequest, fmt.Sprintf("split must be %s or %s, got %s", darknetcfg.Train, darknetcfg.Valid, split))
+	}
+
+	data, err := darknetcfg.ReadDataFile(c.DataFile)
+	if err != nil {
+		return Error(err)
+	}
+	entries, err := dataset.Read(data, c.Storage)
+	if err != nil {
+		return Error(err)
+	}
+
+	page := &LabelledImages{Offset: offset, Limit: limit, Items: []*LabelledImageItem{}}
+	for _, e := range entries {
+		if split != "" && e.Split != split {
+			continue
+		}
+		//images without a readable label file have no boxes
+		labels, _ := dataset.ReadLabels(e)
+		item := &LabelledImageItem{
+			ID:      e.ID(),
+			Split:   string(e.Split),
+			Path:    e.Path,
+			Image:   labelImageURL(e.ID()),
+			Boxes:   len(labels),
+			Classes: []int{},
+		}
+		seen := map[int]bool{}
+		for _, l := range labels {
+			if !seen[l.Class] {
+				seen[l.Class] = true
+				item.Classes = append(item.Classes, l.Class)
+			}
+		}
+		if class >= 0 && !seen[class] {
+			continue
+		}
+
+		if page.Total >= offset && len(page.Items) < limit {
+			page.Items = append(page.Items, item)
+		}
+		page.Total++
+	}
+	return JSON(page)
+}
+
+// findLabelledImage returns the first entry of the train and valid lists with the id of the md5 path variable, or a
+// response to return instead
+func (c *DarknetController) findLabelledImage(r *http.Request) (*darknetcfg.DarknetData, *dataset.Entry, Response) {
+	id := mux.Vars(r)["md5"]
+	data, err := darknetcfg.ReadDataFile(c.DataFile)
+	if err != nil {
+		return nil, nil, Error(err)
+	}
+	entries, err := dataset.Read(data, c.Storage)
+	if err != nil {
+		return nil, nil, Error(err)
+	}
+	for _, e := range entries {
+		if e.ID() == id {
+			return data, e, nil
+		}
+	}
+	return nil, nil, ErrorString(http.StatusNotFound, fmt.Sprintf("no image %s in the train or valid list", id))
+}
+
+// imageSize decodes the size of the image of an entry
+func imageSize(e *dataset.Entry) (image.Rectangle, error) {
+	fh, err := os.Open(e.Image.String())
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	defer fh.Close()
+	config, _, err := image.DecodeConfig(fh)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("%s: %v", e.Path, err)
+	}
+	return image.Rect(0, 0, config.Width, config.Height), nil
+}
+
+// ReportLabel reports an image of the train or valid list and its labels in pixels
+func (c *DarknetController) ReportLabel(ctx Context) Response {
+	_, e, resp := c.findLabelledImage(ctx.Request)
+	if resp != nil {
+		return resp
+	}
+	size, err := imageSize(e)
+	if err != nil {
+		return Error(err)
+	}
+	labels, err := darknet.ParseLabelFile(size, e.Label())
+	if err != nil && !os.IsNotExist(err) {
+		return Error(err)
+	}
+	if labels == nil {
+		labels = darknet.Labels{}
+	}
+	return JSON(&LabelledImage{
+		ID:     e.ID(),
+		Split:  string(e.Split),
+		Path:   e.Path,
+		Image:  labelImageURL(e.ID()),
+		Width:  size.Dx(),
+		Height: size.Dy(),
+		Labels: labels,
+	})
+}
+
+// ReportLabelImage responds with an image of the train or valid list
+func (c *DarknetController) ReportLabelImage(ctx Context) Response {
+	_, e, resp := c.findLabelledImage(ctx.Request)
+	if resp != nil {
+		return resp
+	}
+	buf, err := ioutil.ReadFile(e.Image.String())
+	if os.IsNotExist(err) {
+		return ErrorString(http.StatusNotFound, fmt.Sprintf("the image of %s is missing", e.Path))
+	}
+	if err != nil {
+		return Error(err)
+	}
+	return Data(http.DetectContentType(buf), buf)
+}
+
+// UpdateLabel replaces the labels of an image of the train or valid list with the labels in pixels of the request body
+func (c *DarknetController) UpdateLabel(ctx Context) Response {
+	unlock, err := c.datasetWriter.Lock()
+	if err != nil {
+		return Error(err)
+	}
+	defer unlock()
+	data, e, resp := c.findLabelledImage(ctx.Request)
+	if resp != nil {
+		return resp
+	}
+	var labels darknet.Labels
+	err = json.NewDecoder(ctx.Request.Body).Decode(&labels)
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+	size, err := imageSize(e)
+	if err != nil {
+		return Error(err)
+	}
+	classes, err := dataset.Classes(data)
+	if err != nil {
+		return Error(err)
+	}
+	err = dataset.ValidateLabels(labels, size, classes)
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+
+	err = dataset.WriteLabels(e, size, labels)
+	if err != nil {
+		return Error(err)
+	}
+	return c.ReportLabel(ctx)
+}
+
+// DeleteLabel removes an image from the train and valid lists, and deletes the image and its labels
+func (c *DarknetController) DeleteLabel(ctx Context) Response {
+	unlock, err := c.datasetWriter.Lock()
+	if err != nil {
+		return Error(err)
+	}
+	defer unlock()
+	data, e, resp := c.findLabelledImage(ctx.Request)
+	if resp != nil {
+		return resp
+	}
+	entries, err := dataset.Read(data, c.Storage)
+	if err != nil {
+		return Error(err)
+	}
+	//an image listed more than once is removed from every list
+	var remove []*dataset.Entry
+	for _, o := range entries {
+		if o.Image == e.Image {
+			remove = append(remove, o)
+		}
+	}
+	err = dataset.RemoveEntries(data, remove)
+	if err != nil {
+		return Error(err)
+	}
+	for _, f := range []string{e.Image.String(), e.Label()} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return Error(err)
+		}
+	}
+	return Status(http.StatusNoContent)
+}
+
+// labelFormName matches the names of the parts of a label request, image[0] and label[0] are paired by their index
+// while unindexed image and label parts are paired in order. The parts of requests with parts named otherwise are
+// paired by position.
+var labelFormName = regexp.MustCompile(`^(image|label)(?:\[(\d+)\])?$`)
+
+// LabelUpload is an image to add to the dataset along with its labels in pixels, the image is base64 encoded in json
+type LabelUpload struct {
+	Image  []byte         `json:"image"`
+	Labels darknet.Labels `json:"labels"`
+}
+
+// LabelResult is the outcome of an image of a label request, an error with any image rejects the whole request
+type LabelResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"` //md5 sum of the image
+	Split string `json:"split,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Label adds images along with their labels to the dataset. The request is either a multipart request of image and
+// label parts paired by their names, or a json array of LabelUpload. Every image is validated before any is written,
+// an image listed already keeps its split and has its labels replaced.
+func (c *DarknetController) Label(ctx Context) Response {
+	uploads, err := readLabelUploads(ctx.Request)
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+
+	data, err := darknetcfg.ReadDataFile(c.DataFile)
+	if err != nil {
+		return Error(err)
+	}
+	classes, err := dataset.Classes(data)
+	if err != nil {
+		return Error(err)
+	}
+
+	results := make([]*LabelResult, len(uploads))
+	validated := make([]*dataset.Upload, len(uploads))
+	indexes := map[string]int{}
+	valid := true
+	for i, upload := range uploads {
+		results[i] = &LabelResult{Index: i}
+		u, err := validateLabelUpload(upload, classes)
+		if err == nil {
+			if j, ok := indexes[u.ID]; ok {
+				err = fmt.Errorf("the image is a duplicate of image %d", j)
+			}
+			indexes[u.ID] = i
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			valid = false
+			continue
+		}
+		validated[i] = u
+	}
+	if !valid {
+		return JSON(results, WithStatus(http.StatusBadRequest))
+	}
+
+	entries, err := c.datasetWriter.Add(validated)
+	if err != nil {
+		return Error(err)
+	}
+	for i, e := range entries {
+		results[i].ID = validated[i].ID
+		results[i].Split = string(e.Split)
+	}
+	return JSON(results)
+}
+
+// readLabelUploads reads the images and labels of a label request in the order they appear
+func readLabelUploads(r *http.Request) ([]*LabelUpload, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if mediaType == "application/json" {
+		var uploads []*LabelUpload
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&uploads)
+		if err != nil {
+			return nil, err
+		}
+		if len(uploads) == 0 {
+			return nil, fmt.Errorf("no images to label")
+		}
+		for i, u := range uploads {
+			if u == nil || u.Labels == nil {
+				return nil, fmt.Errorf("image %d lacks labels", i)
+			}
+		}
+		return uploads, nil
+	}
+
+	reader, err := ReadMultipart(r)
+	if err != nil {
+		return nil, err
+	}
+	var parts []*labelPart
+	named := true
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &labelPart{name: part.FormName(), buf: buf})
+		named = named && labelFormName.MatchString(part.FormName())
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no images to label")
+	}
+	if !named {
+		return positionalLabelUploads(parts)
+	}
+
+	var uploads []*LabelUpload
+	keys := map[string]*LabelUpload{}
+	counts := map[string]int{}
+	for _, part := range parts {
+		m := labelFormName.FindStringSubmatch(part.name)
+		field, key := m[1], m[2]
+		if key == "" {
+			key = fmt.Sprintf("#%d", counts[field])
+			counts[field]++
+		}
+		u, ok := keys[key]
+		if !ok {
+			u = &LabelUpload{}
+			keys[key] = u
+			uploads = append(uploads, u)
+		}
+
+		if field == "image" {
+			if u.Image != nil {
+				return nil, fmt.Errorf("more than one %s part", part.name)
+			}
+			u.Image = part.buf
+			continue
+		}
+		if u.Labels != nil {
+			return nil, fmt.Errorf("more than one %s part", part.name)
+		}
+		u.Labels, err = part.labels()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, u := range uploads {
+		if u.Image == nil {
+			return nil, fmt.Errorf("the labels of image %d lack an image part", i)
+		}
+		if u.Labels == nil {
+			return nil, fmt.Errorf("image %d lacks a label part", i)
+		}
+	}
+	return uploads, nil
+}
+
+// labelPart is a part of a multipart label request
+type labelPart struct {
+	name string
+	buf  []byte
+}
+
+// labels decodes the json labels of a part, null being no labels
+func (p *labelPart) labels() (darknet.Labels, error) {
+	var labels darknet.Labels
+	err := json.Unmarshal(p.buf, &labels)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p.name, err)
+	}
+	if labels == nil {
+		labels = darknet.Labels{}
+	}
+	return labels, nil
+}
+
+// positionalLabelUploads pairs the parts of a label request not named after labelFormName by their position, each
+// image followed by its labels, as label requests were paired before parts were named
+func positionalLabelUploads(parts []*labelPart) ([]*LabelUpload, error) {
+	if len(parts)%2 != 0 {
+		return nil, fmt.Errorf("image %d lacks a label part", len(parts)/2)
+	}
+	uploads := make([]*LabelUpload, len(parts)/2)
+	for i := range uploads {
+		labels, err := parts[2*i+1].labels()
+		if err != nil {
+			return nil, err
+		}
+		uploads[i] = &LabelUpload{Image: parts[2*i].buf, Labels: labels}
+	}
+	return uploads, nil
+}
+
+func validateLabelUpload(upload *LabelUpload, classes int) (*dataset.Upload, error) {
+	img, format, err := image.Decode(bytes.NewReader(upload.Image))
+	if err != nil {
+		return nil, err
+	}
+	size := image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	err = dataset.ValidateLabels(upload.Labels, size, classes)
+	if err != nil {
+		return nil, err
+	}
+	return &dataset.Upload{
+		ID:     fmt.Sprintf("%x", md5.Sum(upload.Image)),
+		Format: format,
+		Image:  upload.Image,
+		Size:   size,
+		Labels: upload.Labels,
+	}, nil
+}
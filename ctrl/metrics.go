@@ -0,0 +1,182 @@
+package ctrl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gorilla/mux"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/chart"
+	"github.com/netbrain/darknetw/darknet/darknetrender"
+	"github.com/netbrain/darknetw/session"
+	"image/color"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TrainingMetrics are the loss and mAP curves of a training session
+type TrainingMetrics struct {
+	Session string       `json:"session"`
+	Loss    []*LossPoint `json:"loss"`
+	MAP     []*MAPPoint  `json:"mAP"`
+}
+
+type LossPoint struct {
+	Iteration int       `json:"iteration"`
+	Loss      float64   `json:"loss"`
+	AvgLoss   float64   `json:"avgLoss"`
+	Rate      float64   `json:"rate"`
+	Time      time.Time `json:"time"`
+}
+
+type MAPPoint struct {
+	Iteration int       `json:"iteration"`
+	MAP       float64   `json:"mAP"`
+	Time      time.Time `json:"time"`
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 600
+)
+
+// metricsQuery selects the iterations from through to, keeping one point every iterations
+type metricsQuery struct {
+	from, to, every int
+}
+
+func parseMetricsQuery(query url.Values) (metricsQuery, error) {
+	q := metricsQuery{to: math.MaxInt32}
+	err := parseIntParams(query, intParam{"from", &q.from, 0}, intParam{"to", &q.to, 0}, intParam{"every", &q.every, 1})
+	return q, err
+}
+
+// autoEvery keeps about one metric per pixel of the chart, unless every was given
+func (q metricsQuery) autoEvery(metrics []*session.Metric) metricsQuery {
+	if q.every > 0 || len(metrics) == 0 {
+		return q
+	}
+	first, last := metrics[0].Iteration, metrics[len(metrics)-1].Iteration
+	q.every = 1
+	if span := last - first; span > chartWidth {
+		q.every = span / chartWidth
+	}
+	return q
+}
+
+// ReportTrainingMetrics reports the loss and mAP curves of a training session. The from and to query parameters limit
+// the iterations reported, and every keeps only the latest iteration of each span of that many iterations.
+func (c *DarknetController) ReportTrainingMetrics(ctx Context) Response {
+	q, err := parseMetricsQuery(ctx.Request.URL.Query())
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+	s, resp := c.findSession(mux.Vars(ctx.Request)["id"])
+	if resp != nil {
+		return resp
+	}
+	metrics, err := session.ReadMetrics(s.Dir)
+	if err != nil {
+		return Error(err)
+	}
+	if q.every == 0 {
+		q.every = 1
+	}
+	return JSON(downsampleMetrics(s.ID, metrics, q))
+}
+
+// ReportTrainingChart renders the loss, average loss, learning rate and mAP of a training session as an svg or png
+// chart, accepting the query parameters of ReportTrainingMetrics
+func (c *DarknetController) ReportTrainingChart(ctx Context) Response {
+	q, err := parseMetricsQuery(ctx.Request.URL.Query())
+	if err != nil {
+		return ErrorString(http.StatusBadRequest, err.Error())
+	}
+	s, resp := c.findSession(mux.Vars(ctx.Request)["id"])
+	if resp != nil {
+		return resp
+	}
+	metrics, err := session.ReadMetrics(s.Dir)
+	if err != nil {
+		return Error(err)
+	}
+	ch := trainingChart(downsampleMetrics(s.ID, metrics, q.autoEvery(metrics)))
+
+	buf := &bytes.Buffer{}
+	switch format := mux.Vars(ctx.Request)["format"]; format {
+	case "svg":
+		err = ch.SVG(buf)
+		if err != nil {
+			return Error(err)
+		}
+		return Data("image/svg+xml", buf.Bytes())
+	default:
+		err = darknetrender.Encode(buf, ch.Image(), format)
+		if err != nil {
+			return Error(err)
+		}
+		return Data(darknetrender.ContentType(format), buf.Bytes())
+	}
+}
+
+func trainingChart(tm *TrainingMetrics) *chart.Chart {
+	loss := &chart.Series{Name: "loss", Color: color.RGBA{R: 240, G: 160, B: 160, A: 255}}
+	avgLoss := &chart.Series{Name: "avg loss", Color: color.RGBA{R: 200, G: 30, B: 30, A: 255}}
+	rate := &chart.Series{Name: "learning rate", Color: color.RGBA{R: 30, G: 150, B: 60, A: 255}}
+	mAP := &chart.Series{Name: "mAP", Color: color.RGBA{R: 30, G: 80, B: 200, A: 255}, Right: true, Markers: true}
+	for _, p := range tm.Loss {
+		x := float64(p.Iteration)
+		loss.Points = append(loss.Points, chart.Point{X: x, Y: p.Loss})
+		avgLoss.Points = append(avgLoss.Points, chart.Point{X: x, Y: p.AvgLoss})
+		rate.Points = append(rate.Points, chart.Point{X: x, Y: p.Rate})
+	}
+	for _, p := range tm.MAP {
+		mAP.Points = append(mAP.Points, chart.Point{X: float64(p.Iteration), Y: p.MAP * 100})
+	}
+	return &chart.Chart{
+		Title:  fmt.Sprintf("training session %s", tm.Session),
+		XLabel: "iteration",
+		Width:  chartWidth,
+		Height: chartHeight,
+		Panels: []*chart.Panel{
+			{Weight: 3, Left: "loss", Right: "mAP %", Series: []*chart.Series{loss, avgLoss, mAP}},
+			{Weight: 1, Left: "learning rate", Series: []*chart.Series{rate}},
+		},
+	}
+}
+
+// downsampleMetrics builds the curves of the metrics selected by q. A point is added to the mAP curve whenever the
+// latest mAP changes.
+func downsampleMetrics(id string, metrics []*session.Metric, q metricsQuery) *TrainingMetrics {
+	tm := &TrainingMetrics{
+		Session: id,
+		Loss:    []*LossPoint{},
+		MAP:     []*MAPPoint{},
+	}
+	var mAP *float64
+	for i, m := range metrics {
+		changed := m.MAP != nil && (mAP == nil || *mAP != *m.MAP)
+		if m.MAP != nil {
+			mAP = m.MAP
+		}
+		if m.Iteration < q.from || m.Iteration > q.to {
+			continue
+		}
+		if changed {
+			tm.MAP = append(tm.MAP, &MAPPoint{Iteration: m.Iteration, MAP: *m.MAP, Time: m.Time})
+		}
+		//keep the last metric of each span of every iterations
+		if i+1 < len(metrics) && metrics[i+1].Iteration <= q.to && metrics[i+1].Iteration/q.every == m.Iteration/q.every {
+			continue
+		}
+		tm.Loss = append(tm.Loss, &LossPoint{
+			Iteration: m.Iteration,
+			Loss:      m.Loss,
+			AvgLoss:   m.AvgLoss,
+			Rate:      m.Rate,
+			Time:      m.Time,
+		})
+	}
+	return tm
+}
@@ -0,0 +1,470 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultModelName is the name of the model given by the config, weights and data files of the app config
+const DefaultModelName = "default"
+
+// Model is a loaded detector along with the files it was loaded from
+type Model struct {
+	darknet.Detector
+	ConfigFile  string
+	WeightsFile string
+	DataFile    string
+	LoadedAt    time.Time
+	Size        int64 //estimated memory use in bytes
+	inFlight    sync.WaitGroup
+}
+
+func (m *Model) release() {
+	m.inFlight.Done()
+}
+
+// modTimes returns the modification time of each of the model files
+func (m *Model) modTimes() ([]time.Time, error) {
+	var times []time.Time
+	for _, f := range []string{m.ConfigFile, m.WeightsFile, m.DataFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, fi.ModTime())
+	}
+	return times, nil
+}
+
+// registeredModel is a named model which is loaded upon first use and unloaded when evicted from the memory budget
+type registeredModel struct {
+	name     string
+	files    cfg.ModelConfig
+	model    *Model
+	reload   *ModelReload
+	lastUsed time.Time
+	loadMu   sync.Mutex //serializes loading of the model
+}
+
+// ModelReload is the state of the latest model reload
+type ModelReload struct {
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Config      string    `json:"config"`
+	Weights     string    `json:"weights"`
+	Data        string    `json:"data"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt,omitempty"`
+}
+
+const (
+	ModelReloadLoading = "loading"
+	ModelReloadDone    = "done"
+	ModelReloadFailed  = "failed"
+)
+
+type ModelRequest struct {
+	Config  string `json:"config"`
+	Weights string `json:"weights"`
+	Data    string `json:"data"`
+}
+
+type ModelResponse struct {
+	Name     string       `json:"name"`
+	Config   string       `json:"config"`
+	Weights  string       `json:"weights"`
+	Data     string       `json:"data"`
+	Loaded   bool         `json:"loaded"`
+	LoadedAt *time.Time   `json:"loadedAt,omitempty"`
+	LastUsed *time.Time   `json:"lastUsed,omitempty"`
+	Size     int64        `json:"size,omitempty"`
+	Reload   *ModelReload `json:"reload,omitempty"`
+}
+
+// RegisterModel adds a named model to be served at /api/v1/models/{name}, the model is loaded upon first use. A model
+// named DefaultModelName replaces the model of the app config.
+func (c *DarknetController) RegisterModel(name string, files cfg.ModelConfig) {
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+	c.registerModel(name, files)
+}
+
+func (c *DarknetController) registerModel(name string, files cfg.ModelConfig) *registeredModel {
+	if c.models == nil {
+		c.models = map[string]*registeredModel{}
+	}
+	m := c.models[name]
+	if m == nil {
+		m = &registeredModel{name: name}
+		c.models[name] = m
+	}
+	m.files = files
+	return m
+}
+
+// modelName returns the name of the model a request is made to
+func modelName(r *http.Request) string {
+	if name, ok := mux.Vars(r)["name"]; ok {
+		return name
+	}
+	return DefaultModelName
+}
+
+func (c *DarknetController) lookupModel(name string) (*registeredModel, error) {
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+	m, ok := c.models[name]
+	if !ok {
+		return nil, errNotFound(fmt.Sprintf("no such model: %s", name))
+	}
+	return m, nil
+}
+
+// acquireModel returns the named model, loading it upon first use. The model must be released once the request is
+// done with it, so that a replaced or evicted model is only closed when no longer in use.
+func (c *DarknetController) acquireModel(name string) (*Model, error) {
+	m, err := c.lookupModel(name)
+	if err != nil {
+		return nil, err
+	}
+	if model := c.useModel(m); model != nil {
+		return model, nil
+	}
+
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	if model := c.useModel(m); model != nil {
+		//loaded while waiting for the lock
+		return model, nil
+	}
+
+	c.modelMu.Lock()
+	files := m.files
+	c.modelMu.Unlock()
+	model, err := c.loadModel(m, files)
+	if err != nil {
+		return nil, err
+	}
+	c.setModel(m, model)
+	if model := c.useModel(m); model != nil {
+		return model, nil
+	}
+	return nil, fmt.Errorf("model %s was unloaded while loading", name)
+}
+
+// useModel marks the model as in use and returns it, or returns nil if the model is not loaded
+func (c *DarknetController) useModel(m *registeredModel) *Model {
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+	if m.model == nil {
+		return nil
+	}
+	m.lastUsed = time.Now()
+	m.model.inFlight.Add(1)
+	return m.model
+}
+
+// loadModel loads a pool of PoolSize networks, fronted by a batcher when BatchSize is greater than one. Least recently
+// used models are unloaded beforehand to keep within the memory budget.
+func (c *DarknetController) loadModel(m *registeredModel, files cfg.ModelConfig) (*Model, error) {
+	size := c.modelSize(files)
+	c.modelMu.Lock()
+	c.evictModels(m, size)
+	c.modelMu.Unlock()
+
+	pool, err := darknet.NewPool(c.PoolSize, c.PoolQueueSize, c.PoolWait, func() (darknet.Detector, error) {
+		return c.Backend.LoadDetector(
+			files.Config, files.Data, files.Weights,
+			darknet.WithPreResize(c.PreResize),
+			darknet.WithBatchSize(c.batchSize()),
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	model := &Model{
+		Detector:    pool,
+		ConfigFile:  files.Config,
+		WeightsFile: files.Weights,
+		DataFile:    files.Data,
+		LoadedAt:    time.Now(),
+		Size:        size,
+	}
+	if c.batchSize() > 1 {
+		model.Detector = darknet.NewBatcher(pool, c.batchSize(), c.BatchWindow)
+	}
+	log.Printf("loaded model %s (%s)", m.name, files.Weights)
+	return model, nil
+}
+
+// modelSize estimates the memory used by a model as the size of its weights for every network of the pool
+func (c *DarknetController) modelSize(files cfg.ModelConfig) int64 {
+	fi, err := os.Stat(files.Weights)
+	if err != nil {
+		return 0
+	}
+	size := c.PoolSize
+	if size < 1 {
+		size = 1
+	}
+	return fi.Size() * int64(size)
+}
+
+// evictModels unloads the least recently used models other than keep until size fits within the memory budget. The
+// caller must hold modelMu.
+func (c *DarknetController) evictModels(keep *registeredModel, size int64) {
+	if c.ModelsMemory <= 0 {
+		return
+	}
+	for {
+		used := size
+		var lru *registeredModel
+		for _, m := range c.models {
+			if m == keep || m.model == nil {
+				continue
+			}
+			used += m.model.Size
+			if lru == nil || m.lastUsed.Before(lru.lastUsed) {
+				lru = m
+			}
+		}
+		if used <= c.ModelsMemory || lru == nil {
+			return
+		}
+		log.Printf("unloading model %s to stay within the memory budget", lru.name)
+		closeModel(lru.model)
+		lru.model = nil
+	}
+}
+
+// setModel replaces the loaded model, the previous model is closed once no longer in use
+func (c *DarknetController) setModel(m *registeredModel, model *Model) {
+	c.modelMu.Lock()
+	old := m.model
+	m.model = model
+	m.files = cfg.ModelConfig{Config: model.ConfigFile, Weights: model.WeightsFile, Data: model.DataFile}
+	m.lastUsed = time.Now()
+	c.modelMu.Unlock()
+
+	if old != nil {
+		closeModel(old)
+	}
+}
+
+// SwapModel replaces the model registered as name, registering it if needed. The previous model is closed in the
+// background once the predictions in flight on it have completed.
+func (c *DarknetController) SwapModel(name string, model *Model) {
+	c.modelMu.Lock()
+	m := c.registerModel(name, cfg.ModelConfig{})
+	c.modelMu.Unlock()
+	c.setModel(m, model)
+}
+
+// closeModel closes the model in the background once the predictions in flight on it have completed
+func closeModel(model *Model) {
+	go func() {
+		model.inFlight.Wait()
+		if err := model.Close(); err != nil {
+			log.Println(err)
+		}
+		log.Printf("closed model %s", model.WeightsFile)
+	}()
+}
+
+func (c *DarknetController) batchSize() int {
+	if c.BatchSize < 1 {
+		return 1
+	}
+	return c.BatchSize
+}
+
+// ListModels reports every registered model
+func (c *DarknetController) ListModels(_ Context) Response {
+	c.modelMu.Lock()
+	var models []*registeredModel
+	for _, m := range c.models {
+		models = append(models, m)
+	}
+	c.modelMu.Unlock()
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].name < models[j].name
+	})
+
+	response := []ModelResponse{}
+	for _, m := range models {
+		response = append(response, c.modelResponse(m))
+	}
+	return JSON(response)
+}
+
+// ReportModel reports the files of a model and the state of its latest reload
+func (c *DarknetController) ReportModel(ctx Context) Response {
+	m, err := c.lookupModel(modelName(ctx.Request))
+	if err != nil {
+		return NotFound()
+	}
+	return JSON(c.modelResponse(m))
+}
+
+// ReloadModel loads a new config/weights/data triple of a model in the background and swaps it in for new predictions
+// once loaded. Files left out of the request default to those of the current model.
+func (c *DarknetController) ReloadModel(ctx Context) Response {
+	m, err := c.lookupModel(modelName(ctx.Request))
+	if err != nil {
+		return NotFound()
+	}
+
+	data := &ModelRequest{}
+	if ctx.Request.ContentLength > 0 {
+		err := json.NewDecoder(ctx.Request.Body).Decode(data)
+		if err != nil {
+			return BadRequest()
+		}
+	}
+	current := c.modelResponse(m)
+	if data.Config == "" {
+		data.Config = current.Config
+	}
+	if data.Weights == "" {
+		data.Weights = current.Weights
+	}
+	if data.Data == "" {
+		data.Data = current.Data
+	}
+	for _, f := range []string{data.Config, data.Weights, data.Data} {
+		if _, err := os.Stat(f); err != nil {
+			return ErrorString(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	files := cfg.ModelConfig(*data)
+	if !c.startReload(m, files) {
+		return ErrorString(http.StatusConflict, "a model reload is already in progress")
+	}
+	go c.finishReload(m, files)
+
+	return JSON(c.modelResponse(m), WithStatus(http.StatusAccepted))
+}
+
+// startReload records a new reload in progress, returns false if one is already in progress
+func (c *DarknetController) startReload(m *registeredModel, files cfg.ModelConfig) bool {
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+	if m.reload != nil && m.reload.Status == ModelReloadLoading {
+		return false
+	}
+	m.reload = &ModelReload{
+		Status:    ModelReloadLoading,
+		Config:    files.Config,
+		Weights:   files.Weights,
+		Data:      files.Data,
+		StartedAt: time.Now(),
+	}
+	return true
+}
+
+func (c *DarknetController) finishReload(m *registeredModel, files cfg.ModelConfig) error {
+	m.loadMu.Lock()
+	model, err := c.loadModel(m, files)
+	if err == nil {
+		c.setModel(m, model)
+	}
+	m.loadMu.Unlock()
+
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+	reload := *m.reload
+	reload.CompletedAt = time.Now()
+	reload.Status = ModelReloadDone
+	if err != nil {
+		log.Println(err)
+		reload.Status = ModelReloadFailed
+		reload.Error = err.Error()
+	}
+	m.reload = &reload
+	return err
+}
+
+func (c *DarknetController) modelResponse(m *registeredModel) ModelResponse {
+	c.modelMu.Lock()
+	defer c.modelMu.Unlock()
+	response := ModelResponse{
+		Name:    m.name,
+		Config:  m.files.Config,
+		Weights: m.files.Weights,
+		Data:    m.files.Data,
+		Reload:  m.reload,
+	}
+	if m.model != nil {
+		loadedAt, lastUsed := m.model.LoadedAt, m.lastUsed
+		response.Loaded = true
+		response.LoadedAt = &loadedAt
+		response.LastUsed = &lastUsed
+		response.Size = m.model.Size
+	}
+	return response
+}
+
+// WatchModels polls the files of the loaded models every interval and reloads a model once a changed file has been
+// left untouched for a whole interval, so files which are still being written are not picked up. Files which failed to
+// load are retried once they change again. It returns when stop is closed.
+func (c *DarknetController) WatchModels(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := map[string]string{}
+	failed := map[string]string{} //modification times of the files which failed to load
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		loaded := map[*registeredModel]*Model{}
+		c.modelMu.Lock()
+		for _, m := range c.models {
+			if m.model != nil {
+				//models which are not loaded pick up the latest files upon first use
+				loaded[m] = m.model
+			}
+		}
+		c.modelMu.Unlock()
+
+		for m, model := range loaded {
+			times, err := model.modTimes()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			changed := false
+			for _, t := range times {
+				if t.After(model.LoadedAt) {
+					changed = true
+				}
+			}
+			if !changed || fmt.Sprint(times) != previous[m.name] || fmt.Sprint(times) == failed[m.name] {
+				previous[m.name] = fmt.Sprint(times)
+				continue
+			}
+
+			files := cfg.ModelConfig{Config: model.ConfigFile, Weights: model.WeightsFile, Data: model.DataFile}
+			if c.startReload(m, files) {
+				log.Printf("model files changed, reloading %s", m.name)
+				if err := c.finishReload(m, files); err != nil {
+					failed[m.name] = fmt.Sprint(times)
+				}
+			}
+		}
+	}
+}
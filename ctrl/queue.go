@@ -0,0 +1,303 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/session"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	JobQueued      = "queued"
+	JobRunning     = "running"
+	JobCompleted   = "completed"
+	JobFailed      = "failed"
+	JobCancelled   = "cancelled"
+	JobInterrupted = "interrupted" //the server stopped while the job was running
+)
+
+// maxFinishedJobs is the number of finished jobs kept in the queue
+const maxFinishedJobs = 100
+
+// TrainingJob is a training request in the training queue
+type TrainingJob struct {
+	ID       int             `json:"id"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Request  TrainingRequest `json:"request"`
+	Session  string          `json:"session,omitempty"` //id of the session the job trained
+	Enqueued time.Time       `json:"enqueued"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+// TrainingQueue is a persistent FIFO queue of training jobs, which are run one at a time by RunTrainingQueue
+type TrainingQueue struct {
+	path   string
+	mu     sync.Mutex
+	jobs   []*TrainingJob
+	notify chan struct{}
+}
+
+type QueuedTrainingJob struct {
+	TrainingJob
+	Position int `json:"position,omitempty"` //position among the queued jobs, starting at 1
+}
+
+// OpenTrainingQueue reads the queue stored at path, an absent file is an empty queue
+func OpenTrainingQueue(path string) (*TrainingQueue, error) {
+	q := &TrainingQueue{
+		path:   path,
+		notify: make(chan struct{}, 1),
+	}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &q.jobs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return q, nil
+}
+
+// Enqueue appends a job for req to the queue
+func (q *TrainingQueue) Enqueue(req TrainingRequest) (*QueuedTrainingJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := 1
+	if len(q.jobs) > 0 {
+		id = q.jobs[len(q.jobs)-1].ID + 1
+	}
+	job := &TrainingJob{
+		ID:       id,
+		Status:   JobQueued,
+		Request:  req,
+		Enqueued: time.Now(),
+	}
+	q.jobs = append(q.jobs, job)
+	if err := q.save(); err != nil {
+		q.jobs = q.jobs[:len(q.jobs)-1]
+		return nil, err
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	for _, j := range q.list() {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("job %d is missing from the queue", id)
+}
+
+// Jobs returns a copy of every job in the queue along with the position of the queued jobs
+func (q *TrainingQueue) Jobs() []*QueuedTrainingJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.list()
+}
+
+func (q *TrainingQueue) list() []*QueuedTrainingJob {
+	jobs := []*QueuedTrainingJob{}
+	position := 0
+	for _, job := range q.jobs {
+		j := &QueuedTrainingJob{TrainingJob: *job}
+		if job.Status == JobQueued {
+			position++
+			j.Position = position
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// next returns the id and request of the first queued job
+func (q *TrainingQueue) next() (int, TrainingRequest, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.jobs {
+		if job.Status == JobQueued {
+			return job.ID, job.Request, true
+		}
+	}
+	return 0, TrainingRequest{}, false
+}
+
+// update applies fn to the job of id and saves the queue
+func (q *TrainingQueue) update(id int, fn func(job *TrainingJob)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.jobs {
+		if job.ID == id {
+			fn(job)
+		}
+	}
+	if err := q.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// save writes the queue, pruning the oldest finished jobs. The caller must hold mu.
+func (q *TrainingQueue) save() error {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.Finished != nil {
+			finished++
+		}
+	}
+	var jobs []*TrainingJob
+	for _, job := range q.jobs {
+		if job.Finished != nil && finished > maxFinishedJobs {
+			finished--
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	q.jobs = jobs
+
+	buf, err := json.MarshalIndent(q.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// trainingQueue opens the training queue upon first use
+func (c *DarknetController) trainingQueue() (*TrainingQueue, error) {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	if c.queue != nil {
+		return c.queue, nil
+	}
+	queue, err := OpenTrainingQueue(c.TrainingQueuePath())
+	if err != nil {
+		return nil, err
+	}
+	c.queue = queue
+	return queue, nil
+}
+
+// enqueueTraining enqueues req and responds with the queued job
+func (c *DarknetController) enqueueTraining(req TrainingRequest) Response {
+	queue, err := c.trainingQueue()
+	if err != nil {
+		return Error(err)
+	}
+	job, err := queue.Enqueue(req)
+	if err != nil {
+		return Error(err)
+	}
+	return JSON(job, WithStatus(http.StatusAccepted), WithHeader("Location", "/api/v1/train/queue"))
+}
+
+// ReportTrainingQueue reports the queued, running and recently finished training jobs
+func (c *DarknetController) ReportTrainingQueue(_ Context) Response {
+	queue, err := c.trainingQueue()
+	if err != nil {
+		return Error(err)
+	}
+	return JSON(queue.Jobs())
+}
+
+// RunTrainingQueue runs the queued training jobs one at a time, waiting for any training started elsewhere to finish
+// first. Jobs left running by a previous server are recorded as interrupted. It returns when stop is closed.
+func (c *DarknetController) RunTrainingQueue(stop <-chan struct{}) error {
+	queue, err := c.trainingQueue()
+	if err != nil {
+		return err
+	}
+	for _, job := range queue.Jobs() {
+		if job.Status == JobRunning {
+			queue.update(job.ID, func(job *TrainingJob) {
+				now := time.Now()
+				job.Status = JobInterrupted
+				job.Finished = &now
+			})
+		}
+	}
+
+	const poll = 5 * time.Second
+	for {
+		id, req, ok := queue.next()
+		if ok && !c.IsTraining() {
+			c.runTrainingJob(queue, id, req)
+			continue
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-queue.notify:
+		case <-time.After(poll):
+		}
+	}
+}
+
+func (c *DarknetController) runTrainingJob(queue *TrainingQueue, id int, req TrainingRequest) {
+	log.Printf("starting training job %d", id)
+	queue.update(id, func(job *TrainingJob) {
+		now := time.Now()
+		job.Status = JobRunning
+		job.Started = &now
+	})
+
+	target, err := c.runTraining(req.args()...)
+
+	var finished TrainingJob
+	queue.update(id, func(job *TrainingJob) {
+		now := time.Now()
+		job.Finished = &now
+		job.Session = target
+		job.Status = JobCompleted
+		if s, e := session.Read(c.TrainingSessionPath(target)); e == nil && target != "" && s.Status == session.Cancelled {
+			job.Status = JobCancelled
+		} else if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		}
+		finished = *job
+	})
+	c.events.publish(EventFinished, target, finished)
+	log.Printf("finished training job %d", id)
+}
+
+// runTraining runs the train command with args and returns the id of the session it trained once it exits
+func (c *DarknetController) runTraining(args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0], append([]string{"train", "--backend", c.BackendName}, args...)...)
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	target := make(chan string)
+	go func() {
+		target <- c.readTrainingOutput(r)
+	}()
+	err := cmd.Wait()
+	_ = w.CloseWithError(err)
+	return <-target, err
+}
@@ -0,0 +1,108 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	. "github.com/netbrain/darknetw/api"
+	"github.com/netbrain/darknetw/session"
+	"net/http"
+	"time"
+)
+
+// ListTrainingSessions reports every training session, oldest first
+func (c *DarknetController) ListTrainingSessions(_ Context) Response {
+	sessions, err := c.readSessions()
+	if err != nil {
+		return Error(err)
+	}
+	if sessions == nil {
+		sessions = []*session.Session{}
+	}
+	return JSON(sessions)
+}
+
+// ReportTrainingSession reports a single training session
+func (c *DarknetController) ReportTrainingSession(ctx Context) Response {
+	s, resp := c.findSession(mux.Vars(ctx.Request)["id"])
+	if resp != nil {
+		return resp
+	}
+	return JSON(s)
+}
+
+// StopTraining cancels the running training session once its latest weights are saved. It waits up to the wait query
+// parameter (30s by default) for training to stop, responding with 202 Accepted if it is still stopping by then.
+func (c *DarknetController) StopTraining(ctx Context) Response {
+	wait := 30 * time.Second
+	if v := ctx.Request.URL.Query().Get("wait"); v != "" {
+		var err error
+		wait, err = time.ParseDuration(v)
+		if err != nil {
+			return ErrorString(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	s, stopped, err := session.Stop(c.AppConfig, wait)
+	if err == session.ErrNotTraining {
+		return ErrorString(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return Error(err)
+	}
+	if !stopped {
+		return JSON(s, WithStatus(http.StatusAccepted))
+	}
+	return JSON(s)
+}
+
+// ResumeTraining enqueues a training job resuming an interrupted training session from its latest weights, reusing its
+// dataset and config
+func (c *DarknetController) ResumeTraining(ctx Context) Response {
+	s, resp := c.findSession(mux.Vars(ctx.Request)["id"])
+	if resp != nil {
+		return resp
+	}
+	if err := s.CanResume(); err != nil {
+		return ErrorString(http.StatusConflict, err.Error())
+	}
+
+	data := &ResumeTrainingRequest{}
+	if ctx.Request.ContentLength > 0 {
+		err := json.NewDecoder(ctx.Request.Body).Decode(data)
+		if err != nil {
+			return BadRequest()
+		}
+	}
+	return c.enqueueTraining(TrainingRequest{Resume: s.ID, Clear: data.Clear})
+}
+
+type ResumeTrainingRequest struct {
+	Clear bool `json:"clear"`
+}
+
+// findSession returns the session of id, or a response to return instead
+func (c *DarknetController) findSession(id string) (*session.Session, Response) {
+	if !session.ValidID(id) {
+		return nil, NotFound()
+	}
+	sessions, err := c.readSessions()
+	if err != nil {
+		return nil, Error(err)
+	}
+	for _, s := range sessions {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, NotFound()
+}
+
+// readSessions lists the training sessions, marking those no longer training as interrupted
+func (c *DarknetController) readSessions() ([]*session.Session, error) {
+	sessions, err := session.List(c.TrainingBasePath())
+	if err != nil {
+		return nil, err
+	}
+	session.MarkInterrupted(sessions, c.IsTraining())
+	return sessions, nil
+}
@@ -10,6 +10,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -32,6 +33,24 @@ func ReadMultipart(r *http.Request) (*multipart.Reader, error) {
 	return multipart.NewReader(bufio.NewReader(r.Body), boundary), nil
 }
 
+// statusError is returned from request processing callbacks to respond with a specific status code
+type statusError struct {
+	status int
+	text   string
+}
+
+func (e *statusError) Error() string {
+	return e.text
+}
+
+func errBadRequest(text string) error {
+	return &statusError{status: http.StatusBadRequest, text: text}
+}
+
+func errNotFound(text string) error {
+	return &statusError{status: http.StatusNotFound, text: text}
+}
+
 func tryToInt(s string) int {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -81,3 +100,26 @@ func Do(handler http.HandlerFunc, r *http.Request) *http.Response {
 	fmt.Println()*/
 	return w.Result()
 }
+
+// intParam is an integer query parameter of at least min
+type intParam struct {
+	name string
+	v    *int
+	min  int
+}
+
+// parseIntParams sets the params present in query, leaving the absent ones as is
+func parseIntParams(query url.Values, params ...intParam) error {
+	for _, p := range params {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < p.min {
+			return fmt.Errorf("%s must be an integer of at least %d, got %s", p.name, p.min, s)
+		}
+		*p.v = v
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package darknet
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+)
+
+// DefaultBackend is the name of the backend backed by libdarknet, it is only available when built with the darknet
+// build tag.
+const DefaultBackend = "darknet"
+
+// Default detection thresholds used by Detector.Detect
+const (
+	DefaultThresh     = 0.5
+	DefaultHierThresh = 0.5
+	DefaultNMS        = 0.45
+)
+
+// Detector detects objects in images
+type Detector interface {
+	Detect(img image.Image) ([]*Detection, error)
+	DetectCustom(img image.Image, thresh, hierThresh, nms float32) ([]*Detection, error)
+	Close() error
+}
+
+// Trainer trains a neural network (equivalent of darknet detector train). Training is cancelled with ctx, in which case
+// Train returns once the latest weights are saved with ctx.Err().
+type Trainer interface {
+	Train(ctx context.Context, dataCfg, cfgFile, weightFile string, clear bool, opts ...TrainOption) error
+}
+
+// Validator validates the accuracy of a neural network (equivalent of darknet detector map)
+type Validator interface {
+	Validate(dataCfg, cfgFile, weightFile string) error
+}
+
+// DetectorOptions configures a Detector as it is loaded
+type DetectorOptions struct {
+	PreResize bool //resize images to the network input size in go before handing them to darknet
+	BatchSize int  //number of images detected in a single pass through the network
+}
+
+type DetectorOption func(o *DetectorOptions)
+
+// WithPreResize enables resizing images to the network input size in go
+func WithPreResize(enabled bool) DetectorOption {
+	return func(o *DetectorOptions) {
+		o.PreResize = enabled
+	}
+}
+
+// WithBatchSize sets the number of images the detector is able to detect in a single pass through the network
+func WithBatchSize(size int) DetectorOption {
+	return func(o *DetectorOptions) {
+		o.BatchSize = size
+	}
+}
+
+// NewDetectorOptions applies opts to the default DetectorOptions
+func NewDetectorOptions(opts ...DetectorOption) *DetectorOptions {
+	o := &DetectorOptions{BatchSize: 1}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = 1
+	}
+	return o
+}
+
+// TrainOptions configures darknet while training
+type TrainOptions struct {
+	GPUs            []int `json:"gpus"`            //indexes of the gpus to train on
+	CalcMAP         bool  `json:"calcMap"`         //calculate the mAP of the validation set during training
+	MJPEGPort       int   `json:"mjpegPort"`       //port serving the training chart as mjpeg, zero disables it
+	BenchmarkLayers bool  `json:"benchmarkLayers"` //report the time spent in each layer
+}
+
+type TrainOption func(o *TrainOptions)
+
+// WithGPUs sets the gpus to train on
+func WithGPUs(gpus ...int) TrainOption {
+	return func(o *TrainOptions) {
+		o.GPUs = gpus
+	}
+}
+
+// WithCalcMAP enables calculating the mAP during training
+func WithCalcMAP(enabled bool) TrainOption {
+	return func(o *TrainOptions) {
+		o.CalcMAP = enabled
+	}
+}
+
+// WithMJPEGPort sets the port serving the training chart as mjpeg
+func WithMJPEGPort(port int) TrainOption {
+	return func(o *TrainOptions) {
+		o.MJPEGPort = port
+	}
+}
+
+// WithBenchmarkLayers enables benchmarking the layers during training
+func WithBenchmarkLayers(enabled bool) TrainOption {
+	return func(o *TrainOptions) {
+		o.BenchmarkLayers = enabled
+	}
+}
+
+// NewTrainOptions applies opts to the default TrainOptions, which train on gpu 0 and calculate the mAP
+func NewTrainOptions(opts ...TrainOption) *TrainOptions {
+	o := &TrainOptions{CalcMAP: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(o.GPUs) == 0 {
+		o.GPUs = []int{0}
+	}
+	return o
+}
+
+// Options returns the options reproducing o
+func (o *TrainOptions) Options() []TrainOption {
+	return []TrainOption{
+		WithGPUs(o.GPUs...),
+		WithCalcMAP(o.CalcMAP),
+		WithMJPEGPort(o.MJPEGPort),
+		WithBenchmarkLayers(o.BenchmarkLayers),
+	}
+}
+
+// Validate reports whether o can be passed on to darknet
+func (o *TrainOptions) Validate() error {
+	seen := map[int]bool{}
+	for _, gpu := range o.GPUs {
+		if gpu < 0 {
+			return fmt.Errorf("gpu must be a non-negative index, got %d", gpu)
+		}
+		if seen[gpu] {
+			return fmt.Errorf("gpu %d is listed more than once", gpu)
+		}
+		seen[gpu] = true
+	}
+	if o.MJPEGPort < 0 || o.MJPEGPort > 65535 {
+		return fmt.Errorf("mjpeg port must be between 0 and 65535, got %d", o.MJPEGPort)
+	}
+	return nil
+}
+
+// Backend provides the detection, training and validation implementations
+type Backend interface {
+	LoadDetector(configFile, dataFile, weightsFile string, opts ...DetectorOption) (Detector, error)
+	Trainer
+	Validator
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Backend{}
+)
+
+// RegisterBackend makes a backend available by the provided name. If RegisterBackend is called twice with the same
+// name or if backend is nil, it panics.
+func RegisterBackend(name string, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if backend == nil {
+		panic("darknet: RegisterBackend backend is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("darknet: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = backend
+}
+
+// LookupBackend returns the backend registered by the given name
+func LookupBackend(name string) (Backend, error) {
+	backendsMu.RLock()
+	backend, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		if name == DefaultBackend {
+			return nil, fmt.Errorf("backend %q is not available, build with -tags darknet", name)
+		}
+		return nil, fmt.Errorf("unknown backend %q (available: %v)", name, Backends())
+	}
+	return backend, nil
+}
+
+// Backends returns a sorted list of the names of the registered backends
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
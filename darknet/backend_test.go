@@ -0,0 +1,20 @@
+package darknet
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTrainOptions(t *testing.T) {
+	o := NewTrainOptions()
+	require.Equal(t, &TrainOptions{GPUs: []int{0}, CalcMAP: true}, o)
+	require.NoError(t, o.Validate())
+
+	o = NewTrainOptions(WithGPUs(0, 1), WithCalcMAP(false), WithMJPEGPort(8090), WithBenchmarkLayers(true))
+	require.NoError(t, o.Validate())
+	require.Equal(t, o, NewTrainOptions(o.Options()...))
+
+	for _, opt := range []TrainOption{WithGPUs(-1), WithGPUs(1, 1), WithMJPEGPort(-1), WithMJPEGPort(65536)} {
+		require.Error(t, NewTrainOptions(opt).Validate())
+	}
+}
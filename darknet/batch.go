@@ -0,0 +1,140 @@
+package darknet
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// BatchDetector is a Detector able to detect objects in several images in a single pass through the network
+type BatchDetector interface {
+	Detector
+	DetectBatch(imgs []image.Image, thresh, hierThresh, nms float32) ([][]*Detection, error)
+	BatchSize() int
+}
+
+// DetectBatch detects objects in imgs, as a single batch if d is a BatchDetector or one image at a time otherwise
+func DetectBatch(d Detector, imgs []image.Image, thresh, hierThresh, nms float32) ([][]*Detection, error) {
+	if bd, ok := d.(BatchDetector); ok {
+		return bd.DetectBatch(imgs, thresh, hierThresh, nms)
+	}
+	out := make([][]*Detection, len(imgs))
+	for i, img := range imgs {
+		dets, err := d.DetectCustom(img, thresh, hierThresh, nms)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = dets
+	}
+	return out, nil
+}
+
+// Batcher is a Detector collecting concurrent detections into batches. A batch is run once it holds size images or
+// once the first image of the batch has waited for window, whichever comes first. Only detections with equal
+// thresholds are batched together.
+type Batcher struct {
+	detector Detector
+	size     int
+	window   time.Duration
+
+	mu      sync.Mutex
+	pending map[batchKey]*batch
+}
+
+type batchKey struct {
+	thresh, hierThresh, nms float32
+}
+
+type batch struct {
+	imgs    []image.Image
+	results []chan batchResult
+	timer   *time.Timer
+}
+
+type batchResult struct {
+	detections []*Detection
+	err        error
+}
+
+// NewBatcher returns a Batcher running batches of at most size images through detector
+func NewBatcher(detector Detector, size int, window time.Duration) *Batcher {
+	if size < 1 {
+		size = 1
+	}
+	return &Batcher{
+		detector: detector,
+		size:     size,
+		window:   window,
+		pending:  map[batchKey]*batch{},
+	}
+}
+
+func (b *Batcher) BatchSize() int {
+	return b.size
+}
+
+func (b *Batcher) Detect(img image.Image) ([]*Detection, error) {
+	return b.DetectCustom(img, DefaultThresh, DefaultHierThresh, DefaultNMS)
+}
+
+func (b *Batcher) DetectCustom(img image.Image, thresh, hierThresh, nms float32) ([]*Detection, error) {
+	key := batchKey{thresh: thresh, hierThresh: hierThresh, nms: nms}
+	result := make(chan batchResult, 1)
+
+	b.mu.Lock()
+	bt := b.pending[key]
+	if bt == nil {
+		bt = &batch{}
+		b.pending[key] = bt
+		bt.timer = time.AfterFunc(b.window, func() {
+			b.flush(key, bt)
+		})
+	}
+	bt.imgs = append(bt.imgs, img)
+	bt.results = append(bt.results, result)
+	full := len(bt.imgs) >= b.size
+	if full {
+		delete(b.pending, key)
+		bt.timer.Stop()
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.run(key, bt)
+	}
+	r := <-result
+	return r.detections, r.err
+}
+
+// DetectBatch runs imgs through the underlying detector right away, bypassing any pending batches
+func (b *Batcher) DetectBatch(imgs []image.Image, thresh, hierThresh, nms float32) ([][]*Detection, error) {
+	return DetectBatch(b.detector, imgs, thresh, hierThresh, nms)
+}
+
+func (b *Batcher) flush(key batchKey, bt *batch) {
+	b.mu.Lock()
+	if b.pending[key] != bt {
+		//the batch filled up and is already running
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, key)
+	b.mu.Unlock()
+	b.run(key, bt)
+}
+
+func (b *Batcher) run(key batchKey, bt *batch) {
+	detections, err := DetectBatch(b.detector, bt.imgs, key.thresh, key.hierThresh, key.nms)
+	for i, result := range bt.results {
+		if err != nil {
+			result <- batchResult{err: err}
+			continue
+		}
+		result <- batchResult{detections: detections[i]}
+	}
+}
+
+// Close closes the underlying detector
+func (b *Batcher) Close() error {
+	return b.detector.Close()
+}
@@ -0,0 +1,74 @@
+package darknet
+
+import (
+	"github.com/stretchr/testify/require"
+	"image"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingBatchDetector struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (d *recordingBatchDetector) Detect(img image.Image) ([]*Detection, error) {
+	return d.DetectCustom(img, DefaultThresh, DefaultHierThresh, DefaultNMS)
+}
+
+func (d *recordingBatchDetector) DetectCustom(img image.Image, thresh, hierThresh, nms float32) ([]*Detection, error) {
+	dets, err := d.DetectBatch([]image.Image{img}, thresh, hierThresh, nms)
+	if err != nil {
+		return nil, err
+	}
+	return dets[0], nil
+}
+
+func (d *recordingBatchDetector) DetectBatch(imgs []image.Image, thresh, hierThresh, nms float32) ([][]*Detection, error) {
+	d.mu.Lock()
+	d.batches = append(d.batches, len(imgs))
+	d.mu.Unlock()
+	out := make([][]*Detection, len(imgs))
+	for i, img := range imgs {
+		//echo the image width so results can be matched to their images
+		out[i] = []*Detection{{Label: Label{X2: float64(img.Bounds().Dx())}, Confidence: thresh}}
+	}
+	return out, nil
+}
+
+func (d *recordingBatchDetector) BatchSize() int {
+	return 4
+}
+
+func (d *recordingBatchDetector) Close() error {
+	return nil
+}
+
+func TestBatcher(t *testing.T) {
+	detector := &recordingBatchDetector{}
+	batcher := NewBatcher(detector, 4, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	detect := func(width int, thresh float32) {
+		defer wg.Done()
+		dets, err := batcher.DetectCustom(image.NewGray(image.Rect(0, 0, width, 1)), thresh, 0.5, 0.45)
+		require.NoError(t, err)
+		require.Len(t, dets, 1)
+		require.Equal(t, float64(width), dets[0].X2)
+		require.Equal(t, thresh, dets[0].Confidence)
+	}
+
+	//a full batch runs right away, the differing threshold and the remainder run when the window elapses
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go detect(i, 0.5)
+	}
+	wg.Add(1)
+	go detect(10, 0.25)
+	wg.Wait()
+
+	sort.Ints(detector.batches)
+	require.Equal(t, []int{1, 1, 4}, detector.batches)
+}
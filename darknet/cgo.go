@@ -1,3 +1,6 @@
+//go:build darknet
+// +build darknet
+
 package darknet
 
 // #cgo CFLAGS: -I${SRCDIR}/../include -I/usr/local/cuda/include
@@ -0,0 +1,92 @@
+//go:build darknet
+// +build darknet
+
+package darknet
+
+import (
+	"context"
+	"fmt"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterBackend(DefaultBackend, cgoBackend{})
+}
+
+// cgoBackend implements Backend by calling into libdarknet
+type cgoBackend struct{}
+
+func (cgoBackend) LoadDetector(configFile, dataFile, weightsFile string, opts ...DetectorOption) (Detector, error) {
+	o := NewDetectorOptions(opts...)
+	net := LoadNetworkCustom(configFile, dataFile, weightsFile, o.BatchSize)
+	net.PreResize = o.PreResize
+	return net, nil
+}
+
+// Train runs darknet in the background. As darknet can not be interrupted, a cancelled training waits for darknet to
+// save its _last weights before giving up on it, leaving it to the caller to exit the process.
+func (cgoBackend) Train(ctx context.Context, dataCfg, cfgFile, weightFile string, clear bool, opts ...TrainOption) error {
+	if err := NewTrainOptions(opts...).Validate(); err != nil {
+		return err
+	}
+	data, err := darknetcfg.ReadDataFile(dataCfg)
+	if err != nil {
+		return err
+	}
+	last := filepath.Join(
+		data.Get(darknetcfg.Backup),
+		fmt.Sprintf("%s_last.weights", strings.TrimSuffix(filepath.Base(cfgFile), filepath.Ext(cfgFile))),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		TrainDetectorCustom(dataCfg, cfgFile, weightFile, clear, opts...)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	log.Printf("training cancelled, waiting for %s to be saved", last)
+	waitForSave(last, done, time.Second)
+	return ctx.Err()
+}
+
+// waitForSave blocks until file is rewritten and its size has settled for an interval, or until done is closed
+func waitForSave(file string, done <-chan struct{}, interval time.Duration) {
+	var since time.Time
+	if fi, err := os.Stat(file); err == nil {
+		since = fi.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous os.FileInfo
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(file)
+		if err != nil || !fi.ModTime().After(since) {
+			continue
+		}
+		if previous != nil && previous.Size() == fi.Size() && previous.ModTime().Equal(fi.ModTime()) {
+			return
+		}
+		previous = fi
+	}
+}
+
+func (cgoBackend) Validate(dataCfg, cfgFile, weightFile string) error {
+	ValidateDetectorMap(dataCfg, cfgFile, weightFile)
+	return nil
+}
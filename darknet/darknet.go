@@ -1,3 +1,6 @@
+//go:build darknet
+// +build darknet
+
 package darknet
 
 import "unsafe"
@@ -10,9 +13,13 @@ func LoadNetwork(configFile, dataFile, weightsFile string) *Network {
 }
 
 func LoadNetworkCustom(configFile, dataFile, weightsFile string, batchSize int) *Network {
+	if batchSize < 1 {
+		batchSize = 1
+	}
 	net := &Network{
 		CNetwork:  C.load_network_custom(C.CString(configFile), C.CString(weightsFile), C.int(0), C.int(batchSize)),
 		CMetadata: C.get_metadata(C.CString(dataFile)),
+		batchSize: batchSize,
 	}
 	classes := int(net.CMetadata.classes)
 	cnames := (*[1 << 30]*C.char)(unsafe.Pointer(net.CMetadata.names))[:classes:classes]
@@ -28,17 +35,19 @@ func TrainDetector(dataCfg, cfgFile, weightFile string) {
 	TrainDetectorCustom(dataCfg, cfgFile, weightFile, false)
 }
 
-func TrainDetectorCustom(dataCfg, cfgFile, weightFile string, clear bool, gpus ...int) {
+func TrainDetectorCustom(dataCfg, cfgFile, weightFile string, clear bool, opts ...TrainOption) {
 	defer C.fflush(C.stdout)
-	if gpus == nil {
-		gpus = []int{0}
+	o := NewTrainOptions(opts...)
+	gpus := make([]C.int, len(o.GPUs))
+	for i, gpu := range o.GPUs {
+		gpus[i] = C.int(gpu)
 	}
 	var cWeightFile *C.char
 	if weightFile != "" {
 		cWeightFile = C.CString(weightFile)
 	}
 	//LIB_API void train_detector(char *datacfg, char *cfgfile, char *weightfile, int *gpus, int ngpus, int clear, int dont_show, int calc_map, int mjpeg_port, int show_imgs, int benchmark_layers, char* chart_path);
-	C.train_detector(C.CString(dataCfg), C.CString(cfgFile), cWeightFile, (*C.int)(unsafe.Pointer(&gpus[0])), C.int(len(gpus)), boolToCInt(clear), C.int(1), C.int(1), C.int(0), C.int(0), C.int(0), nil)
+	C.train_detector(C.CString(dataCfg), C.CString(cfgFile), cWeightFile, &gpus[0], C.int(len(gpus)), boolToCInt(clear), C.int(1), boolToCInt(o.CalcMAP), C.int(o.MJPEGPort), C.int(0), boolToCInt(o.BenchmarkLayers), nil)
 }
 
 func ValidateDetectorMap(dataCfg, cfgFile, weightFile string) {
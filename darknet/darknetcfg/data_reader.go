@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"path/filepath"
 )
 
@@ -124,9 +123,11 @@ func scanData(data []byte, atEOF bool) (advance int, token []byte, err error) {
 		return 0, nil, nil
 	}
 
-	eq := bytes.IndexByte(data, '=')
-	nl := bytes.IndexByte(data, '\n')
-	i := int(math.Min(float64(eq), float64(nl)))
+	//split at whichever of the key/value separator or line end comes first
+	i := bytes.IndexByte(data, '=')
+	if nl := bytes.IndexByte(data, '\n'); nl >= 0 && (i < 0 || nl < i) {
+		i = nl
+	}
 
 	if i >= 0 {
 		// We have a full newline-terminated line.
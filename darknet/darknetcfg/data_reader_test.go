@@ -55,6 +55,17 @@ func TestReadDataFile(t *testing.T) {
 			"names = names.txt")
 }
 
+func TestReadData_NoTrailingNewline(t *testing.T) {
+	data, err := ReadData(bytes.NewBufferString("classes = 6\nbackup = weights"))
+	require.NoError(t, err)
+	require.Equal(t, "6", data.Get(Classes))
+	require.Equal(t, "weights", data.Get(Backup))
+
+	roundTrip, err := ReadData(bytes.NewBufferString(data.String()))
+	require.NoError(t, err)
+	require.Equal(t, data.String(), roundTrip.String())
+}
+
 func TestDarknetData_Set(t *testing.T) {
 	data := &DarknetData{}
 	data.Set(Classes, "6")
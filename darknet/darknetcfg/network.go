@@ -0,0 +1,454 @@
+package darknetcfg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Network is a darknet network config file (.cfg). It is parsed losslessly, writing an unmodified network returns the
+// file it was read from byte for byte, including comments, blank lines and the order of the sections and options.
+type Network struct {
+	preamble []*networkLine //lines preceding the first section
+	sections []*Section
+}
+
+// Section is a section of a network config, such as [net], [convolutional] or [yolo]
+type Section struct {
+	name   string
+	header *networkLine
+	lines  []*networkLine //lines following the header up to the next section
+}
+
+type networkLine struct {
+	raw string //without the line terminator
+	eol string //line terminator, empty on the last line of a file lacking one
+}
+
+// ReadNetworkFile parses a darknet network config file
+func ReadNetworkFile(fp string) (*Network, error) {
+	buf, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	n, err := ReadNetwork(bytes.NewBuffer(buf))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fp, err)
+	}
+	return n, nil
+}
+
+// ReadNetwork parses a darknet network config
+func ReadNetwork(r io.Reader) (*Network, error) {
+	br := bufio.NewReader(r)
+	n := &Network{}
+	for i := 1; ; i++ {
+		raw, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if raw == "" && err == io.EOF {
+			break
+		}
+		l := &networkLine{raw: raw}
+		for _, eol := range []string{"\r\n", "\n"} {
+			if strings.HasSuffix(raw, eol) {
+				l.raw, l.eol = strings.TrimSuffix(raw, eol), eol
+				break
+			}
+		}
+
+		if name, ok := l.section(); ok {
+			if name == "" {
+				return nil, fmt.Errorf("line %d: section without a name", i)
+			}
+			n.sections = append(n.sections, &Section{name: name, header: l})
+		} else if len(n.sections) == 0 {
+			if _, _, ok := l.option(); ok {
+				return nil, fmt.Errorf("line %d: option outside of a section", i)
+			}
+			n.preamble = append(n.preamble, l)
+		} else {
+			s := n.sections[len(n.sections)-1]
+			s.lines = append(s.lines, l)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return n, nil
+}
+
+// section returns the name of the section the line starts
+func (l *networkLine) section() (string, bool) {
+	s := strings.TrimSpace(l.raw)
+	if !strings.HasPrefix(s, "[") {
+		return "", false
+	}
+	end := strings.Index(s, "]")
+	if end < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(s[1:end]), true
+}
+
+// option returns the key and value of an option line, comments start with # or ; like darknet expects
+func (l *networkLine) option() (key, value string, ok bool) {
+	s := strings.TrimSpace(l.raw)
+	if s == "" || s[0] == '#' || s[0] == ';' {
+		return "", "", false
+	}
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+}
+
+// setValue replaces the value of an option line, keeping the formatting around the =
+func (l *networkLine) setValue(value string) {
+	i := strings.Index(l.raw, "=")
+	prefix := l.raw[:i+1]
+	rest := l.raw[i+1:]
+	prefix += rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	l.raw = prefix + value
+}
+
+// Sections returns every section in order
+func (n *Network) Sections() []*Section {
+	return n.sections
+}
+
+// SectionsNamed returns the sections of the given name in order, such as every [yolo] section
+func (n *Network) SectionsNamed(name string) []*Section {
+	var sections []*Section
+	for _, s := range n.sections {
+		if s.name == name {
+			sections = append(sections, s)
+		}
+	}
+	return sections
+}
+
+// Net returns the [net] section, which darknet also accepts as [network]
+func (n *Network) Net() *Section {
+	for _, s := range n.sections {
+		if s.name == "net" || s.name == "network" {
+			return s
+		}
+	}
+	return nil
+}
+
+// Index returns the position of s among the sections, or -1 if s is not part of the network
+func (n *Network) Index(s *Section) int {
+	for i, o := range n.sections {
+		if o == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *Network) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	_, _ = n.WriteTo(buf)
+	return buf.Bytes()
+}
+
+func (n *Network) String() string {
+	return string(n.Bytes())
+}
+
+// WriteTo writes the network config to w
+func (n *Network) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var written int64
+	write := func(l *networkLine) error {
+		c, err := bw.WriteString(l.raw + l.eol)
+		written += int64(c)
+		return err
+	}
+	for _, l := range n.preamble {
+		if err := write(l); err != nil {
+			return written, err
+		}
+	}
+	for _, s := range n.sections {
+		for _, l := range append([]*networkLine{s.header}, s.lines...) {
+			if err := write(l); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, bw.Flush()
+}
+
+// WriteFile writes the network config to fp, replacing it atomically
+func (n *Network) WriteFile(fp string) error {
+	tmp := fp + ".tmp"
+	if err := ioutil.WriteFile(tmp, n.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
+
+// Name returns the name of the section without brackets
+func (s *Section) Name() string {
+	return s.name
+}
+
+// Keys returns the keys of the options of the section in order
+func (s *Section) Keys() []string {
+	var keys []string
+	for _, l := range s.lines {
+		if key, _, ok := l.option(); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Get returns the value of the first option of key, like darknet does
+func (s *Section) Get(key string) (string, bool) {
+	if l := s.find(key); l != nil {
+		_, value, _ := l.option()
+		return value, true
+	}
+	return "", false
+}
+
+// GetInt returns the value of key as an integer, or def if the section lacks key
+func (s *Section) GetInt(key string, def int) (int, error) {
+	value, ok := s.Get(key)
+	if !ok {
+		return def, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("[%s] %s: %v", s.name, key, err)
+	}
+	return i, nil
+}
+
+// GetInts returns the comma separated value of key as integers, such as the mask of a [yolo] section
+func (s *Section) GetInts(key string) ([]int, error) {
+	value, ok := s.Get(key)
+	if !ok || value == "" {
+		return nil, nil
+	}
+	var ints []int
+	for _, v := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %s: %v", s.name, key, err)
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// Set sets the value of the first option of key, appending the option after the last option of the section if absent
+func (s *Section) Set(key, value string) {
+	if l := s.find(key); l != nil {
+		l.setValue(value)
+		return
+	}
+	i := 0
+	for j, o := range s.lines {
+		if _, _, ok := o.option(); ok {
+			i = j + 1
+		}
+	}
+	previous := s.header
+	if i > 0 {
+		previous = s.lines[i-1]
+	}
+	l := &networkLine{raw: fmt.Sprintf("%s=%s", key, value), eol: previous.eol}
+	//the option takes over the line terminator of the line it follows, should that be the last line of the file
+	if previous.eol == "" {
+		previous.eol = "\n"
+	}
+	s.lines = append(s.lines[:i], append([]*networkLine{l}, s.lines[i:]...)...)
+}
+
+// SetInt sets the value of key to an integer
+func (s *Section) SetInt(key string, value int) {
+	s.Set(key, strconv.Itoa(value))
+}
+
+// SetInts sets the value of key to comma separated integers
+func (s *Section) SetInts(key string, values ...int) {
+	v := make([]string, len(values))
+	for i, value := range values {
+		v[i] = strconv.Itoa(value)
+	}
+	s.Set(key, strings.Join(v, ","))
+}
+
+// Delete removes every option of key
+func (s *Section) Delete(key string) {
+	lines := s.lines[:0]
+	for _, l := range s.lines {
+		if k, _, ok := l.option(); ok && k == key {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	s.lines = lines
+}
+
+func (s *Section) find(key string) *networkLine {
+	for _, l := range s.lines {
+		if k, _, ok := l.option(); ok && k == key {
+			return l
+		}
+	}
+	return nil
+}
+
+// AdjustClasses sets the number of classes of every [yolo] section, and the filters of the [convolutional] section
+// preceding it to (classes+5)*masks. The training schedule of [net] is scaled along, max_batches to classes*2000 and
+// steps to 80% and 90% of it. It returns a description of every value changed.
+func (n *Network) AdjustClasses(classes int) ([]string, error) {
+	if classes < 1 {
+		return nil, fmt.Errorf("the number of classes must be positive, got %d", classes)
+	}
+	var changes []string
+	set := func(s *Section, key, value string) {
+		changes = n.change(changes, s, key, value)
+	}
+
+	yolos := n.SectionsNamed("yolo")
+	if len(yolos) == 0 {
+		return nil, fmt.Errorf("the network has no [yolo] sections")
+	}
+	for _, yolo := range yolos {
+		masks, err := yolo.GetInts("mask")
+		if err != nil {
+			return nil, err
+		}
+		num, err := yolo.GetInt("num", 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(masks) == 0 {
+			//without a mask the layer uses every anchor
+			masks = make([]int, num)
+		}
+
+		conv, err := n.convolutional(yolo)
+		if err != nil {
+			return nil, err
+		}
+		set(yolo, "classes", strconv.Itoa(classes))
+		set(conv, "filters", strconv.Itoa((classes+5)*len(masks)))
+	}
+
+	if net := n.Net(); net != nil {
+		maxBatches := classes * 2000
+		set(net, "max_batches", strconv.Itoa(maxBatches))
+		set(net, "steps", fmt.Sprintf("%d,%d", maxBatches*8/10, maxBatches*9/10))
+	}
+	return changes, nil
+}
+
+// SetAnchors sets the anchors of every [yolo] section, given as width and height pairs in pixels of the network input.
+// The masks are kept when the number of anchors is unchanged. Otherwise the anchors are divided evenly among the [yolo]
+// sections in the order of their current masks, and num and the filters of the preceding [convolutional] sections are
+// adjusted along. It returns a description of every value changed.
+func (n *Network) SetAnchors(anchors [][2]int) ([]string, error) {
+	yolos := n.SectionsNamed("yolo")
+	if len(yolos) == 0 {
+		return nil, fmt.Errorf("the network has no [yolo] sections")
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no anchors given")
+	}
+	pairs := make([]string, len(anchors))
+	for i, a := range anchors {
+		pairs[i] = fmt.Sprintf("%d,%d", a[0], a[1])
+	}
+	value := strings.Join(pairs, ", ")
+
+	var changes []string
+	set := func(s *Section, key, value string) {
+		changes = n.change(changes, s, key, value)
+	}
+
+	masks := make([][]int, len(yolos))
+	keep := true
+	for i, yolo := range yolos {
+		num, err := yolo.GetInt("num", 1)
+		if err != nil {
+			return nil, err
+		}
+		masks[i], err = yolo.GetInts("mask")
+		if err != nil {
+			return nil, err
+		}
+		keep = keep && num == len(anchors)
+	}
+	if keep {
+		for _, yolo := range yolos {
+			set(yolo, "anchors", value)
+		}
+		return changes, nil
+	}
+
+	if len(anchors)%len(yolos) != 0 {
+		return nil, fmt.Errorf("%d anchors can't be divided evenly among %d [yolo] sections", len(anchors), len(yolos))
+	}
+	per := len(anchors) / len(yolos)
+	//the coarsest layer detects the largest objects, it comes first in yolov3 like networks and last in yolov4 like ones
+	descending := len(masks[0]) == 0 || len(masks[len(masks)-1]) == 0 || masks[0][0] >= masks[len(masks)-1][0]
+	for i, yolo := range yolos {
+		group := i
+		if descending {
+			group = len(yolos) - 1 - i
+		}
+		mask := make([]string, per)
+		for j := range mask {
+			mask[j] = strconv.Itoa(group*per + j)
+		}
+		//darknet defaults to 20 classes
+		classes, err := yolo.GetInt("classes", 20)
+		if err != nil {
+			return nil, err
+		}
+		conv, err := n.convolutional(yolo)
+		if err != nil {
+			return nil, err
+		}
+		set(yolo, "mask", strings.Join(mask, ","))
+		set(yolo, "anchors", value)
+		set(yolo, "num", strconv.Itoa(len(anchors)))
+		set(conv, "filters", strconv.Itoa((classes+5)*per))
+	}
+	return changes, nil
+}
+
+// change sets key of s to value, appending a description of the change to changes if the value differs
+func (n *Network) change(changes []string, s *Section, key, value string) []string {
+	old, _ := s.Get(key)
+	if old == value {
+		return changes
+	}
+	s.Set(key, value)
+	return append(changes, fmt.Sprintf("[%s] #%d %s: %q -> %q", s.name, n.Index(s), key, old, value))
+}
+
+// convolutional returns the [convolutional] section preceding s, which outputs the predictions of a [yolo] section
+func (n *Network) convolutional(s *Section) (*Section, error) {
+	for i := n.Index(s) - 1; i >= 0; i-- {
+		if n.sections[i].name == "convolutional" {
+			return n.sections[i], nil
+		}
+	}
+	return nil, fmt.Errorf("[%s] #%d is not preceded by a [convolutional] section", s.name, n.Index(s))
+}
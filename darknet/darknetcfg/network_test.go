@@ -0,0 +1,208 @@
+package darknetcfg
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testNetwork = `# tiny yolo
+[net]
+batch=64
+subdivisions = 8
+width=416
+max_batches = 500200
+steps=400000,450000
+
+[convolutional]
+filters=255
+activation=linear
+
+; detection layer
+[yolo]
+mask = 3,4,5
+classes=80
+num=6
+
+[route]
+layers = -4
+
+[convolutional]
+filters=255
+
+[yolo]
+mask = 0,1,2
+classes=80`
+
+func TestReadNetwork_RoundTrip(t *testing.T) {
+	for _, cfg := range []string{testNetwork, testNetwork + "\n", "\n\n" + testNetwork, string(bytes.ReplaceAll([]byte(testNetwork), []byte("\n"), []byte("\r\n")))} {
+		n, err := ReadNetwork(bytes.NewBufferString(cfg))
+		require.NoError(t, err)
+		require.Equal(t, cfg, n.String())
+	}
+}
+
+func TestReadNetwork(t *testing.T) {
+	n, err := ReadNetwork(bytes.NewBufferString(testNetwork))
+	require.NoError(t, err)
+
+	var names []string
+	for _, s := range n.Sections() {
+		names = append(names, s.Name())
+	}
+	require.Equal(t, []string{"net", "convolutional", "yolo", "route", "convolutional", "yolo"}, names)
+	require.Equal(t, []string{"batch", "subdivisions", "width", "max_batches", "steps"}, n.Net().Keys())
+
+	subdivisions, err := n.Net().GetInt("subdivisions", 1)
+	require.NoError(t, err)
+	require.Equal(t, 8, subdivisions)
+	height, err := n.Net().GetInt("height", 416)
+	require.NoError(t, err)
+	require.Equal(t, 416, height)
+
+	yolos := n.SectionsNamed("yolo")
+	require.Len(t, yolos, 2)
+	require.Equal(t, 2, n.Index(yolos[0]))
+	mask, err := yolos[1].GetInts("mask")
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2}, mask)
+	_, ok := yolos[0].Get("anchors")
+	require.False(t, ok)
+
+	_, err = n.SectionsNamed("route")[0].GetInt("layers", 0)
+	require.NoError(t, err)
+	_, err = n.Net().GetInt("steps", 0)
+	require.Error(t, err)
+}
+
+func TestNetwork_Modify(t *testing.T) {
+	n, err := ReadNetwork(bytes.NewBufferString(testNetwork))
+	require.NoError(t, err)
+
+	n.Net().SetInt("subdivisions", 16)
+	n.Net().SetInts("steps", 1600, 1800)
+	n.Net().Set("height", "416")
+	n.SectionsNamed("convolutional")[0].Delete("activation")
+	for _, yolo := range n.SectionsNamed("yolo") {
+		yolo.SetInt("classes", 2)
+	}
+	n.SectionsNamed("route")[0].Set("groups", "2")
+
+	require.Equal(t, `# tiny yolo
+[net]
+batch=64
+subdivisions = 16
+width=416
+max_batches = 500200
+steps=1600,1800
+height=416
+
+[convolutional]
+filters=255
+
+; detection layer
+[yolo]
+mask = 3,4,5
+classes=2
+num=6
+
+[route]
+layers = -4
+groups=2
+
+[convolutional]
+filters=255
+
+[yolo]
+mask = 0,1,2
+classes=2`, n.String())
+}
+
+func TestReadNetwork_Invalid(t *testing.T) {
+	for _, cfg := range []string{"batch=64\n[net]", "[]\nbatch=64"} {
+		_, err := ReadNetwork(bytes.NewBufferString(cfg))
+		require.Error(t, err, cfg)
+	}
+}
+
+func TestNetwork_WriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "network.cfg")
+	require.NoError(t, ioutil.WriteFile(fp, []byte(testNetwork), 0644))
+	n, err := ReadNetworkFile(fp)
+	require.NoError(t, err)
+	n.Net().SetInt("batch", 1)
+	require.NoError(t, n.WriteFile(fp))
+
+	n, err = ReadNetworkFile(fp)
+	require.NoError(t, err)
+	batch, err := n.Net().GetInt("batch", 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, batch)
+}
+
+func TestNetwork_AdjustClasses(t *testing.T) {
+	n, err := ReadNetwork(bytes.NewBufferString(testNetwork))
+	require.NoError(t, err)
+
+	changes, err := n.AdjustClasses(2)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`[yolo] #2 classes: "80" -> "2"`,
+		`[convolutional] #1 filters: "255" -> "21"`,
+		`[yolo] #5 classes: "80" -> "2"`,
+		`[convolutional] #4 filters: "255" -> "21"`,
+		`[net] #0 max_batches: "500200" -> "4000"`,
+		`[net] #0 steps: "400000,450000" -> "3200,3600"`,
+	}, changes)
+	require.Contains(t, n.String(), "max_batches = 4000\n")
+
+	//an adjusted network is left as is
+	changes, err = n.AdjustClasses(2)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	_, err = n.AdjustClasses(0)
+	require.Error(t, err)
+	n, err = ReadNetwork(bytes.NewBufferString("[net]\nbatch=1\n[yolo]\nclasses=80"))
+	require.NoError(t, err)
+	_, err = n.AdjustClasses(2)
+	require.Error(t, err, "missing [convolutional]")
+}
+
+func TestNetwork_SetAnchors(t *testing.T) {
+	n, err := ReadNetwork(bytes.NewBufferString(testNetwork))
+	require.NoError(t, err)
+	yolos := n.SectionsNamed("yolo")
+	yolos[1].SetInt("num", 6)
+
+	//the masks are kept as is for as many anchors
+	anchors := [][2]int{{10, 14}, {23, 27}, {37, 58}, {81, 82}, {135, 169}, {344, 319}}
+	changes, err := n.SetAnchors(anchors)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`[yolo] #2 anchors: "" -> "10,14, 23,27, 37,58, 81,82, 135,169, 344,319"`,
+		`[yolo] #5 anchors: "" -> "10,14, 23,27, 37,58, 81,82, 135,169, 344,319"`,
+	}, changes)
+
+	//the largest anchors go to the first [yolo] section, which had them before
+	n.SectionsNamed("yolo")[0].SetInt("classes", 2)
+	changes, err = n.SetAnchors(append(anchors, [2]int{400, 400}, [2]int{410, 410}))
+	require.NoError(t, err)
+	require.Contains(t, changes, `[yolo] #2 mask: "3,4,5" -> "4,5,6,7"`)
+	require.Contains(t, changes, `[convolutional] #1 filters: "255" -> "28"`)
+	require.Contains(t, changes, `[yolo] #5 mask: "0,1,2" -> "0,1,2,3"`)
+	require.Contains(t, changes, `[yolo] #5 num: "6" -> "8"`)
+	require.Contains(t, changes, `[convolutional] #4 filters: "255" -> "340"`)
+
+	_, err = n.SetAnchors(anchors[:3])
+	require.Error(t, err, "3 anchors among 2 [yolo] sections")
+	_, err = n.SetAnchors(nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package darknetrender
+
+import (
+	"fmt"
+	"github.com/netbrain/darknetw/darknet"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+)
+
+// DefaultRenderer is the Renderer used by Render
+var DefaultRenderer = &Renderer{
+	Thickness: 2,
+	Face:      basicfont.Face7x13,
+}
+
+// Renderer draws detections as bounding boxes with a text label holding the class name and confidence
+type Renderer struct {
+	Thickness int       //bounding box line thickness in pixels
+	Face      font.Face //font used for the text labels
+}
+
+// Render draws the detections onto a copy of src using the DefaultRenderer
+func Render(src image.Image, detections []*darknet.Detection) *image.RGBA {
+	return DefaultRenderer.Render(src, detections)
+}
+
+// Render draws the detections onto a copy of src
+func (r *Renderer) Render(src image.Image, detections []*darknet.Detection) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+
+	for _, d := range detections {
+		c := ClassColor(d.Class)
+		box := d.Rectangle().Add(bounds.Min).Intersect(bounds)
+		if box.Empty() {
+			continue
+		}
+		r.box(dst, box, c)
+		r.label(dst, box, labelText(d), c)
+	}
+	return dst
+}
+
+func (r *Renderer) box(dst *image.RGBA, box image.Rectangle, c color.Color) {
+	t := r.Thickness
+	if t < 1 {
+		t = 1
+	}
+	src := image.NewUniform(c)
+	for _, edge := range []image.Rectangle{
+		image.Rect(box.Min.X, box.Min.Y, box.Max.X, box.Min.Y+t),
+		image.Rect(box.Min.X, box.Max.Y-t, box.Max.X, box.Max.Y),
+		image.Rect(box.Min.X, box.Min.Y, box.Min.X+t, box.Max.Y),
+		image.Rect(box.Max.X-t, box.Min.Y, box.Max.X, box.Max.Y),
+	} {
+		draw.Draw(dst, edge.Intersect(box), src, image.Point{}, draw.Src)
+	}
+}
+
+func (r *Renderer) label(dst *image.RGBA, box image.Rectangle, text string, c color.RGBA) {
+	face := r.Face
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+	metrics := face.Metrics()
+	height := (metrics.Ascent + metrics.Descent).Ceil() + 2
+	width := font.MeasureString(face, text).Ceil() + 4
+
+	//place the label above the box, or inside it when there is no room
+	bg := image.Rect(box.Min.X, box.Min.Y-height, box.Min.X+width, box.Min.Y)
+	if bg.Min.Y < dst.Bounds().Min.Y {
+		bg = bg.Add(image.Pt(0, height))
+	}
+	draw.Draw(dst, bg.Intersect(dst.Bounds()), image.NewUniform(c), image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(textColor(c)),
+		Face: face,
+		Dot:  fixed.P(bg.Min.X+2, bg.Min.Y+1+metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(text)
+}
+
+func labelText(d *darknet.Detection) string {
+	name := d.ClassName
+	if name == "" {
+		name = fmt.Sprint(d.Class)
+	}
+	return fmt.Sprintf("%s %.0f%%", name, d.Confidence*100)
+}
+
+// ClassColor returns a color for the given class, neighbouring classes are given distinct hues
+func ClassColor(class int) color.RGBA {
+	//spread hues using the golden ratio to keep consecutive classes apart
+	h := math.Mod(float64(class)*0.618033988749895, 1)
+	return hsv(h, 0.85, 0.95)
+}
+
+func hsv(h, s, v float64) color.RGBA {
+	i := math.Floor(h * 6)
+	f := h*6 - i
+	p := v * (1 - s)
+	q := v * (1 - f*s)
+	t := v * (1 - (1-f)*s)
+	var r, g, b float64
+	switch int(i) % 6 {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+	return color.RGBA{R: uint8(r * 255), G: uint8(g * 255), B: uint8(b * 255), A: 255}
+}
+
+// textColor returns black or white, whichever is more readable on top of c
+func textColor(c color.RGBA) color.Color {
+	luminance := 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	if luminance > 140 {
+		return color.Black
+	}
+	return color.White
+}
+
+// Encode writes img to w in the given format, either "jpeg" or "png"
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpeg.DefaultQuality})
+	case "png":
+		return png.Encode(w, img)
+	default:
+		return fmt.Errorf("unsupported image format %q", format)
+	}
+}
+
+// ContentType returns the mime type of the given format
+func ContentType(format string) string {
+	return "image/" + format
+}
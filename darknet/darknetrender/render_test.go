@@ -0,0 +1,36 @@
+package darknetrender
+
+import (
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	dst := Render(src, []*darknet.Detection{
+		{
+			Label:      darknet.Label{X1: 20, Y1: 30, X2: 80, Y2: 90, Class: 3},
+			ClassName:  "rectangle",
+			Confidence: 0.5,
+		},
+	})
+
+	require.Equal(t, src.Bounds(), dst.Bounds())
+	require.Equal(t, ClassColor(3), dst.RGBAAt(50, 30), "top edge")
+	require.Equal(t, ClassColor(3), dst.RGBAAt(20, 60), "left edge")
+	require.Equal(t, color.RGBA{}, dst.RGBAAt(50, 60), "inside of box")
+	require.Equal(t, color.RGBA{}, dst.RGBAAt(5, 5), "outside of box")
+	require.Equal(t, color.RGBA{}, src.RGBAAt(50, 30), "source is left untouched")
+}
+
+func TestClassColor(t *testing.T) {
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < 20; i++ {
+		c := ClassColor(i)
+		require.False(t, seen[c], "class %d", i)
+		seen[c] = true
+	}
+}
@@ -0,0 +1,317 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendName is the name the fake backend is registered as
+const BackendName = "fake"
+
+func init() {
+	darknet.RegisterBackend(BackendName, &Backend{})
+}
+
+// Backend is a pure go implementation of darknet.Backend. It returns scripted detections and emits darknet like log
+// output, which makes it possible to exercise the api without libdarknet.
+type Backend struct {
+	// Detections are returned in turn for every call to Detect, when empty a single detection of the first class
+	// centered on the image is returned.
+	Detections [][]*darknet.Detection
+	// Iterations is the number of training iterations to emit, defaults to 100
+	Iterations int
+	// Interval is the delay between each emitted training iteration
+	Interval time.Duration
+	// Output is where the log output is written, defaults to os.Stdout
+	Output io.Writer
+}
+
+func (b *Backend) LoadDetector(configFile, dataFile, weightsFile string, opts ...darknet.DetectorOption) (darknet.Detector, error) {
+	for _, f := range []string{configFile, dataFile, weightsFile} {
+		if _, err := os.Stat(f); err != nil {
+			return nil, err
+		}
+	}
+	names, err := readNames(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{
+		ClassNames: names,
+		Detections: b.Detections,
+		Options:    darknet.NewDetectorOptions(opts...),
+	}, nil
+}
+
+// Train emits Iterations training iterations, calculating the mAP at every quarter if enabled. When ctx is cancelled, the
+// _last weights are saved and ctx.Err() is returned.
+func (b *Backend) Train(ctx context.Context, dataCfg, cfgFile, weightFile string, clear bool, opts ...darknet.TrainOption) error {
+	options := darknet.NewTrainOptions(opts...)
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	data, err := darknetcfg.ReadDataFile(dataCfg)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(cfgFile); err != nil {
+		return err
+	}
+
+	out := b.output()
+	iterations := b.Iterations
+	if iterations <= 0 {
+		iterations = 100
+	}
+	checkpoint := iterations / 4
+	if checkpoint == 0 {
+		checkpoint = 1
+	}
+
+	fmt.Fprintf(out, " GPU isn't used \n")
+	fmt.Fprintf(out, "%s\n", filepath.Base(strings.TrimSuffix(cfgFile, filepath.Ext(cfgFile))))
+	var seen int
+	if weightFile != "" {
+		buf, err := ioutil.ReadFile(weightFile)
+		if err != nil {
+			return err
+		}
+		if !clear {
+			//continue from the iteration the weights were saved at, like darknet does
+			_, _ = fmt.Sscanf(string(buf), fakeWeights+" %d", &seen)
+		}
+		fmt.Fprintf(out, "Loading weights from %s...\n Done! Loaded %d layers from weights-file \n", weightFile, 38)
+	}
+	if clear {
+		fmt.Fprintf(out, " clear = 1 \n")
+	}
+	fmt.Fprintf(out, "Learning Rate: 0.00261, Momentum: 0.9, Decay: 0.0005\n")
+	if options.CalcMAP {
+		fmt.Fprintf(out, " (next mAP calculation at %d iterations) \n", checkpoint)
+	}
+
+	backup := data.Get(darknetcfg.Backup)
+	if backup == "" {
+		backup = "backup"
+	}
+	base := filepath.Join(backup, filepath.Base(strings.TrimSuffix(cfgFile, filepath.Ext(cfgFile))))
+
+	avgLoss := float64(-1)
+	var best float64
+	for i := seen + 1; i <= iterations; i++ {
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+		case <-time.After(b.Interval):
+		}
+		if ctx.Err() != nil {
+			if err := b.saveWeights(fmt.Sprintf("%s_last.weights", base), i-1); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+		loss := 500/float64(i) + 0.5 + 0.25*math.Sin(float64(i))
+		if avgLoss < 0 {
+			avgLoss = loss
+		}
+		avgLoss = avgLoss*.9 + loss*.1
+		hoursLeft := float64(iterations-i) * b.Interval.Hours()
+		fmt.Fprintf(out, "\n %d: %f, %f avg loss, %f rate, %f seconds, %d images, %f hours left\n",
+			i, loss, avgLoss, 0.00261, time.Since(start).Seconds(), i*64, hoursLeft)
+
+		if i%checkpoint != 0 || i == iterations {
+			continue
+		}
+
+		if options.CalcMAP {
+			last := float64(i) / float64(iterations) * 0.9
+			if last > best {
+				best = last
+			}
+			fmt.Fprintf(out, "\n mean_average_precision (mAP@0.50) = %f \n", last)
+			fmt.Fprintf(out, "\n Last accuracy mAP@0.50 = %2.2f %%, best = %2.2f %% \n", last*100, best*100)
+		}
+		for _, suffix := range []string{fmt.Sprint(i), "last"} {
+			if err := b.saveWeights(fmt.Sprintf("%s_%s.weights", base, suffix), i); err != nil {
+				return err
+			}
+		}
+	}
+	for _, suffix := range []string{"last", "final"} {
+		if err := b.saveWeights(fmt.Sprintf("%s_%s.weights", base, suffix), iterations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) Validate(dataCfg, cfgFile, weightFile string) error {
+	for _, f := range []string{cfgFile, weightFile} {
+		if _, err := os.Stat(f); err != nil {
+			return err
+		}
+	}
+	names, err := readNames(dataCfg)
+	if err != nil {
+		return err
+	}
+
+	out := b.output()
+	fmt.Fprintf(out, "\n calculation mAP (mean average precision)...\n")
+	fmt.Fprintf(out, " Detection layer: 30 - type = 28 \n")
+	var sum float64
+	for i, name := range names {
+		ap := 0.9 - 0.1*float64(i%5)
+		sum += ap
+		fmt.Fprintf(out, "class_id = %d, name = %s, ap = %2.2f%%   \t (TP = %d, FP = %d) \n", i, name, ap*100, 90-i, 10+i)
+	}
+	mAP := sum / math.Max(1, float64(len(names)))
+	fmt.Fprintf(out, "\n for conf_thresh = %1.2f, precision = %1.2f, recall = %1.2f, F1-score = %1.2f \n", 0.25, 0.9, 0.85, 0.87)
+	fmt.Fprintf(out, " for conf_thresh = %0.2f, TP = %d, FP = %d, FN = %d, average IoU = %2.2f %% \n", 0.25, 85, 8, 15, 70.12)
+	fmt.Fprintf(out, "\n IoU threshold = %2.0f %%, used Area-Under-Curve for each unique Recall \n", 50.0)
+	fmt.Fprintf(out, " mean average precision (mAP@%0.2f) = %f, or %2.2f %% \n", 0.5, mAP, mAP*100)
+	return nil
+}
+
+func (b *Backend) output() io.Writer {
+	if b.Output == nil {
+		return os.Stdout
+	}
+	return b.Output
+}
+
+// fakeWeights is the content of the weights files saved by the fake backend, followed by the iteration
+const fakeWeights = "darknetw fake weights"
+
+func (b *Backend) saveWeights(file string, iteration int) error {
+	fmt.Fprintf(b.output(), "Saving weights to %s\n", file)
+	return ioutil.WriteFile(file, []byte(fmt.Sprintf("%s %d", fakeWeights, iteration)), 0644)
+}
+
+// Detector is a pure go implementation of darknet.Detector returning scripted detections
+type Detector struct {
+	mu         sync.Mutex
+	n          int
+	ClassNames []string
+	Detections [][]*darknet.Detection
+	Options    *darknet.DetectorOptions
+	// Batches holds the number of images in each call to DetectBatch
+	Batches []int
+	closed  bool
+}
+
+func (d *Detector) Detect(img image.Image) ([]*darknet.Detection, error) {
+	return d.DetectCustom(img, darknet.DefaultThresh, darknet.DefaultHierThresh, darknet.DefaultNMS)
+}
+
+// DetectCustom returns the next scripted detections, omitting those with a confidence below thresh
+func (d *Detector) DetectCustom(img image.Image, thresh, hierThresh, nms float32) ([]*darknet.Detection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.Detections) > 0 {
+		var dets []*darknet.Detection
+		for _, det := range d.Detections[d.n%len(d.Detections)] {
+			if det.Confidence >= thresh {
+				dets = append(dets, det)
+			}
+		}
+		d.n++
+		return dets, nil
+	}
+
+	const confidence = 0.9
+	if confidence < thresh {
+		return nil, nil
+	}
+	var className string
+	if len(d.ClassNames) > 0 {
+		className = d.ClassNames[0]
+	}
+	size := img.Bounds()
+	return []*darknet.Detection{
+		{
+			Label: darknet.Label{
+				X1: float64(size.Min.X + size.Dx()/4),
+				Y1: float64(size.Min.Y + size.Dy()/4),
+				X2: float64(size.Max.X - size.Dx()/4),
+				Y2: float64(size.Max.Y - size.Dy()/4),
+			},
+			ClassName:  className,
+			Confidence: confidence,
+		},
+	}, nil
+}
+
+// DetectBatch returns the next scripted detections for each image
+func (d *Detector) DetectBatch(imgs []image.Image, thresh, hierThresh, nms float32) ([][]*darknet.Detection, error) {
+	if len(imgs) > d.BatchSize() {
+		return nil, fmt.Errorf("batch of %d images exceeds the batch size %d", len(imgs), d.BatchSize())
+	}
+	d.mu.Lock()
+	d.Batches = append(d.Batches, len(imgs))
+	d.mu.Unlock()
+
+	out := make([][]*darknet.Detection, len(imgs))
+	for i, img := range imgs {
+		dets, err := d.DetectCustom(img, thresh, hierThresh, nms)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = dets
+	}
+	return out, nil
+}
+
+func (d *Detector) BatchSize() int {
+	if d.Options == nil {
+		return 1
+	}
+	return d.Options.BatchSize
+}
+
+func (d *Detector) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return nil
+}
+
+// Closed reports whether Close has been called
+func (d *Detector) Closed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed
+}
+
+func readNames(dataFile string) ([]string, error) {
+	data, err := darknetcfg.ReadDataFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	namesFile := data.Get(darknetcfg.Names)
+	if namesFile == "" {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(namesFile)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
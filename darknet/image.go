@@ -1,3 +1,6 @@
+//go:build darknet
+// +build darknet
+
 package darknet
 
 // #include <darknet.h>
@@ -5,7 +8,6 @@ import "C"
 import (
 	"bytes"
 	"image"
-	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
@@ -36,24 +38,18 @@ func NewImage(src image.Image) *Image {
 		CImage: C.make_image(C.int(width), C.int(height), 3),
 	}
 
-	wh := width * height
-	channels := 3
-	length := wh * channels
+	length := width * height * 3
 	img.data = (*[1 << 30]float32)(unsafe.Pointer(img.CImage.data))[:length:length]
-
-	for i := 0; i < wh; i++ {
-		x := i % width
-		y := i / width
-		sc := length / 3
-		r, g, b, _ := color.RGBAModel.Convert(src.At(x, y)).RGBA()
-		img.data[i%sc] = float32(r) / 0xFFFF
-		img.data[i%sc+sc] = float32(g) / 0xFFFF
-		img.data[i%sc+sc*2] = float32(b) / 0xFFFF
-	}
+	fillImageData(img.data, src)
 
 	return img
 }
 
+// NewImageResized scales src to the given width and height in go before converting it to a darknet image
+func NewImageResized(src image.Image, width, height int) *Image {
+	return NewImage(resizeImage(src, width, height))
+}
+
 func (i *Image) Close() error {
 	C.free_image(i.CImage)
 	i.data = nil
@@ -0,0 +1,122 @@
+package darknet
+
+import (
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+)
+
+// fillImageData writes the pixels of src to dst as normalized rgb values in planar (channel, row, column) order, which
+// is the layout of a darknet image. dst must hold 3*width*height values. The common decoded image types are read
+// directly from their pixel buffers, any other image type falls back to the considerably slower color model
+// conversion.
+func fillImageData(dst []float32, src image.Image) {
+	switch src := src.(type) {
+	case *image.YCbCr:
+		fillImageDataYCbCr(dst, src)
+	case *image.RGBA:
+		fillImageDataRGBA(dst, src)
+	case *image.NRGBA:
+		fillImageDataNRGBA(dst, src)
+	case *image.Gray:
+		fillImageDataGray(dst, src)
+	default:
+		fillImageDataGeneric(dst, src)
+	}
+}
+
+func fillImageDataGeneric(dst []float32, src image.Image) {
+	b := src.Bounds()
+	width, sc := b.Dx(), b.Dx()*b.Dy()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			r, g, bl, _ := color.RGBAModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).RGBA()
+			dst[i] = float32(r) / 0xFFFF
+			dst[i+sc] = float32(g) / 0xFFFF
+			dst[i+sc*2] = float32(bl) / 0xFFFF
+		}
+	}
+}
+
+func fillImageDataYCbCr(dst []float32, src *image.YCbCr) {
+	b := src.Bounds()
+	width, sc := b.Dx(), b.Dx()*b.Dy()
+
+	//horizontal chroma subsampling, vertical subsampling is handled by COffset for the first column of each row
+	hdiv := 1
+	switch src.SubsampleRatio {
+	case image.YCbCrSubsampleRatio422, image.YCbCrSubsampleRatio420:
+		hdiv = 2
+	case image.YCbCrSubsampleRatio411, image.YCbCrSubsampleRatio410:
+		hdiv = 4
+	}
+
+	for y := 0; y < b.Dy(); y++ {
+		yRow := src.Y[src.YOffset(b.Min.X, b.Min.Y+y):]
+		cRow := src.COffset(b.Min.X, b.Min.Y+y) - b.Min.X/hdiv
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			ci := cRow + (b.Min.X+x)/hdiv
+			r, g, bl := color.YCbCrToRGB(yRow[x], src.Cb[ci], src.Cr[ci])
+			dst[i] = float32(r) / 0xFF
+			dst[i+sc] = float32(g) / 0xFF
+			dst[i+sc*2] = float32(bl) / 0xFF
+		}
+	}
+}
+
+func fillImageDataRGBA(dst []float32, src *image.RGBA) {
+	b := src.Bounds()
+	width, sc := b.Dx(), b.Dx()*b.Dy()
+	for y := 0; y < b.Dy(); y++ {
+		pix := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			dst[i] = float32(pix[x*4]) / 0xFF
+			dst[i+sc] = float32(pix[x*4+1]) / 0xFF
+			dst[i+sc*2] = float32(pix[x*4+2]) / 0xFF
+		}
+	}
+}
+
+func fillImageDataNRGBA(dst []float32, src *image.NRGBA) {
+	b := src.Bounds()
+	width, sc := b.Dx(), b.Dx()*b.Dy()
+	for y := 0; y < b.Dy(); y++ {
+		pix := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			//premultiply by alpha, as done when converting to the rgba color model
+			a := float32(pix[x*4+3]) / 0xFF
+			dst[i] = float32(pix[x*4]) / 0xFF * a
+			dst[i+sc] = float32(pix[x*4+1]) / 0xFF * a
+			dst[i+sc*2] = float32(pix[x*4+2]) / 0xFF * a
+		}
+	}
+}
+
+func fillImageDataGray(dst []float32, src *image.Gray) {
+	b := src.Bounds()
+	width, sc := b.Dx(), b.Dx()*b.Dy()
+	for y := 0; y < b.Dy(); y++ {
+		pix := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			v := float32(pix[x]) / 0xFF
+			dst[i] = v
+			dst[i+sc] = v
+			dst[i+sc*2] = v
+		}
+	}
+}
+
+// resizeImage scales src to the given width and height using approximate bilinear interpolation
+func resizeImage(src image.Image, width, height int) image.Image {
+	if src.Bounds().Dx() == width && src.Bounds().Dy() == height {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,100 @@
+package darknet
+
+import (
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func testImages(width, height int) map[string]image.Image {
+	random := rand.New(rand.NewSource(1))
+	rect := image.Rect(0, 0, width, height)
+
+	rgba := image.NewRGBA(rect)
+	random.Read(rgba.Pix)
+	for i := 3; i < len(rgba.Pix); i += 4 {
+		//keep the pixels valid premultiplied colors
+		rgba.Pix[i] = 0xFF
+	}
+	nrgba := image.NewNRGBA(rect)
+	random.Read(nrgba.Pix)
+	gray := image.NewGray(rect)
+	random.Read(gray.Pix)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	random.Read(ycbcr.Y)
+	random.Read(ycbcr.Cb)
+	random.Read(ycbcr.Cr)
+	cmyk := image.NewCMYK(rect)
+	random.Read(cmyk.Pix)
+
+	return map[string]image.Image{
+		"RGBA":     rgba,
+		"NRGBA":    nrgba,
+		"Gray":     gray,
+		"YCbCr":    ycbcr,
+		"CMYK":     cmyk,
+		"SubImage": ycbcr.SubImage(image.Rect(3, 5, width-7, height-2)),
+	}
+}
+
+func TestFillImageData(t *testing.T) {
+	for name, img := range testImages(64, 48) {
+		t.Run(name, func(t *testing.T) {
+			length := img.Bounds().Dx() * img.Bounds().Dy() * 3
+			expected := make([]float32, length)
+			actual := make([]float32, length)
+			fillImageDataGeneric(expected, img)
+			fillImageData(actual, img)
+			require.InDeltaSlice(t, expected, actual, 1.0/0xFF)
+		})
+	}
+}
+
+func TestFillImageData_Layout(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 0xFF, A: 0xFF})
+	img.Set(1, 0, color.RGBA{B: 0xFF, A: 0xFF})
+	data := make([]float32, 6)
+	fillImageData(data, img)
+	require.Equal(t, []float32{1, 0, 0, 0, 0, 1}, data)
+}
+
+func TestResizeImage(t *testing.T) {
+	img := testImages(64, 48)["YCbCr"]
+	require.Equal(t, image.Rect(0, 0, 32, 32), resizeImage(img, 32, 32).Bounds())
+	require.Equal(t, img, resizeImage(img, 64, 48))
+}
+
+func BenchmarkFillImageData(b *testing.B) {
+	for name, img := range testImages(1920, 1080) {
+		data := make([]float32, img.Bounds().Dx()*img.Bounds().Dy()*3)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fillImageData(data, img)
+			}
+		})
+		b.Run(name+"/Generic", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fillImageDataGeneric(data, img)
+			}
+		})
+	}
+}
+
+func BenchmarkResizeImage(b *testing.B) {
+	img := testImages(1920, 1080)["YCbCr"]
+	data := make([]float32, 416*416*3)
+	b.Run("PreResize", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fillImageData(data, resizeImage(img, 416, 416))
+		}
+	})
+	b.Run("FullSize", func(b *testing.B) {
+		full := make([]float32, 1920*1080*3)
+		for i := 0; i < b.N; i++ {
+			fillImageData(full, img)
+		}
+	})
+}
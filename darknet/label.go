@@ -40,9 +40,12 @@ func ParseLabelFile(size image.Rectangle, file string) (Labels, error) {
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.Split(strings.Trim(string(buf), "\n"), "\n")
 	var labels []*Label
-	for _, l := range lines {
+	for _, l := range strings.Split(string(buf), "\n") {
+		//an image without objects has an empty label file
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
 		label, err := ParseLabel(size, l)
 		if err != nil {
 			return nil, err
@@ -53,8 +56,7 @@ func ParseLabelFile(size image.Rectangle, file string) (Labels, error) {
 }
 
 func ParseLabel(size image.Rectangle, yolo string) (*Label, error) {
-	yolo = strings.TrimSpace(yolo)
-	parts := strings.Split(yolo, " ")
+	parts := strings.Fields(yolo)
 	if len(parts) != 5 {
 		return nil, fmt.Errorf("incorrect format")
 	}
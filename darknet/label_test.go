@@ -3,6 +3,9 @@ package darknet
 import (
 	"github.com/stretchr/testify/require"
 	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -16,3 +19,27 @@ func TestLabel_Yolo(t *testing.T) {
 	result := label.Yolo(size)
 	require.Equal(t, yolo, result)
 }
+
+func TestParseLabelFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "label")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "0.txt")
+	size := image.Rect(0, 0, 100, 100)
+	for content, count := range map[string]int{
+		"":                  0,
+		"\n":                0,
+		"0 0.5 0.5 0.2 0.4": 1,
+		"0 0.5 0.5 0.2 0.4\r\n\n1  0.25 0.25 0.1 0.1\n": 2,
+	} {
+		require.NoError(t, ioutil.WriteFile(fp, []byte(content), 0644))
+		labels, err := ParseLabelFile(size, fp)
+		require.NoError(t, err, content)
+		require.Len(t, labels, count, content)
+	}
+
+	require.NoError(t, ioutil.WriteFile(fp, []byte("0 0.5 0.5 0.2"), 0644))
+	_, err = ParseLabelFile(size, fp)
+	require.Error(t, err)
+}
@@ -1,8 +1,13 @@
+//go:build darknet
+// +build darknet
+
 package darknet
 
 // #include <darknet.h>
 import "C"
 import (
+	"fmt"
+	"image"
 	"sync"
 	"unsafe"
 )
@@ -12,27 +17,98 @@ type Network struct {
 	CNetwork   *C.network
 	CMetadata  C.metadata
 	ClassNames []string
+	PreResize  bool //resize images to the network input size in go rather than in darknet
+	batchSize  int
+}
+
+// Detect converts img to a darknet image and detects objects using the default thresholds
+func (n *Network) Detect(img image.Image) ([]*Detection, error) {
+	return n.DetectCustom(img, DefaultThresh, DefaultHierThresh, DefaultNMS)
+}
+
+// DetectCustom converts img to a darknet image and detects objects using the given thresholds
+func (n *Network) DetectCustom(img image.Image, thresh, hierThresh, nms float32) ([]*Detection, error) {
+	var dimg *Image
+	if n.PreResize {
+		dimg = NewImageResized(img, n.Width(), n.Height())
+	} else {
+		dimg = NewImage(img)
+	}
+	defer dimg.Close()
+	return n.detectImage(dimg, img.Bounds().Dx(), img.Bounds().Dy(), thresh, hierThresh, nms), nil
 }
 
 func (n *Network) DetectImage(image *Image) []*Detection {
-	return n.DetectImageCustom(image, 0.5, 0.5, 0.45)
+	return n.DetectImageCustom(image, DefaultThresh, DefaultHierThresh, DefaultNMS)
 }
 
 func (n *Network) DetectImageCustom(img *Image, thresh, hierThresh, nms float32) []*Detection {
+	return n.detectImage(img, int(img.CImage.w), int(img.CImage.h), thresh, hierThresh, nms)
+}
+
+// detectImage detects objects in img, scaling the detected bounding boxes to imgWidth and imgHeight
+func (n *Network) detectImage(img *Image, imgWidth, imgHeight int, thresh, hierThresh, nms float32) []*Detection {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	width := C.network_width(n.CNetwork)
 	height := C.network_height(n.CNetwork)
 	num := C.int(0)
 
-	resizedImg := C.resize_image(img.CImage, width, height)
-	defer C.free_image(resizedImg)
+	resizedImg := img.CImage
+	if img.CImage.w != width || img.CImage.h != height {
+		resizedImg = C.resize_image(img.CImage, width, height)
+		defer C.free_image(resizedImg)
+	}
 
 	C.network_predict(*n.CNetwork, resizedImg.data)
 
 	detections := C.get_network_boxes(n.CNetwork, width, height, C.float(thresh), C.float(hierThresh), nil, 1, (*C.int)(&num), 0)
 	defer C.free_detections(detections, num)
 
+	return n.toDetections(detections, num, imgWidth, imgHeight, thresh, nms)
+}
+
+// DetectBatch resizes imgs to the network input size and detects objects in all of them in a single pass through the
+// network. At most BatchSize images can be detected at once.
+func (n *Network) DetectBatch(imgs []image.Image, thresh, hierThresh, nms float32) ([][]*Detection, error) {
+	if len(imgs) > n.BatchSize() {
+		return nil, fmt.Errorf("darknet: batch of %d images exceeds the network batch size %d", len(imgs), n.BatchSize())
+	}
+	width, height := n.Width(), n.Height()
+	batchSize := n.BatchSize()
+
+	batch := C.make_image(C.int(width), C.int(height), C.int(3*batchSize))
+	defer C.free_image(batch)
+	length := width * height * 3
+	data := (*[1 << 30]float32)(unsafe.Pointer(batch.data))[: length*batchSize : length*batchSize]
+	for i, img := range imgs {
+		fillImageData(data[i*length:(i+1)*length], resizeImage(img, width, height))
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	pairs := C.network_predict_batch(n.CNetwork, batch, C.int(batchSize), C.int(width), C.int(height), C.float(thresh), C.float(hierThresh), nil, 1, 0)
+	defer C.free_batch_detections(pairs, C.int(batchSize))
+
+	cpairs := (*[1 << 30]C.det_num_pair)(unsafe.Pointer(pairs))[:batchSize:batchSize]
+	out := make([][]*Detection, len(imgs))
+	for i, img := range imgs {
+		out[i] = n.toDetections(cpairs[i].dets, cpairs[i].num, img.Bounds().Dx(), img.Bounds().Dy(), thresh, nms)
+	}
+	return out, nil
+}
+
+// BatchSize returns the number of images the network detects in a single pass
+func (n *Network) BatchSize() int {
+	if n.batchSize < 1 {
+		return 1
+	}
+	return n.batchSize
+}
+
+// toDetections applies non-maximum suppression and converts the darknet detections above thresh, scaling the relative
+// bounding boxes to imgWidth and imgHeight
+func (n *Network) toDetections(detections *C.detection, num C.int, imgWidth, imgHeight int, thresh, nms float32) []*Detection {
 	if nms > 0 {
 		C.do_nms_sort(detections, num, n.CMetadata.classes, C.float(nms))
 	}
@@ -50,10 +126,10 @@ func (n *Network) DetectImageCustom(img *Image, thresh, hierThresh, nms float32)
 			}
 			dets = append(dets, &Detection{
 				Label: Label{
-					X1:    float64((float32(cdet.bbox.x) - float32(cdet.bbox.w)/2.0) * float32(img.CImage.w)),
-					Y1:    float64((float32(cdet.bbox.y) - float32(cdet.bbox.h)/2.0) * float32(img.CImage.h)),
-					X2:    float64((float32(cdet.bbox.x) + float32(cdet.bbox.w)/2.0) * float32(img.CImage.w)),
-					Y2:    float64((float32(cdet.bbox.y) + float32(cdet.bbox.h)/2.0) * float32(img.CImage.h)),
+					X1:    float64((float32(cdet.bbox.x) - float32(cdet.bbox.w)/2.0) * float32(imgWidth)),
+					Y1:    float64((float32(cdet.bbox.y) - float32(cdet.bbox.h)/2.0) * float32(imgHeight)),
+					X2:    float64((float32(cdet.bbox.x) + float32(cdet.bbox.w)/2.0) * float32(imgWidth)),
+					Y2:    float64((float32(cdet.bbox.y) + float32(cdet.bbox.h)/2.0) * float32(imgHeight)),
 					Class: i,
 				},
 				ClassName:  n.ClassNames[i],
@@ -65,6 +141,16 @@ func (n *Network) DetectImageCustom(img *Image, thresh, hierThresh, nms float32)
 	return dets
 }
 
+// Width returns the input width of the network
+func (n *Network) Width() int {
+	return int(C.network_width(n.CNetwork))
+}
+
+// Height returns the input height of the network
+func (n *Network) Height() int {
+	return int(C.network_height(n.CNetwork))
+}
+
 func (n *Network) Close() error {
 	C.free_network(*n.CNetwork)
 	return nil
@@ -0,0 +1,146 @@
+package darknet
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPoolBusy is returned when a detection could not be queued or timed out waiting for a detector
+	ErrPoolBusy = errors.New("darknet: all detectors are busy")
+	// ErrPoolClosed is returned when detecting on a closed pool
+	ErrPoolClosed = errors.New("darknet: detector pool is closed")
+)
+
+// Pool is a Detector which distributes detections across a fixed number of loaded detectors. Detections exceeding the
+// number of detectors are queued, a detection is rejected with ErrPoolBusy if the queue is full or if it has waited
+// longer than the configured wait duration.
+type Pool struct {
+	detectors chan Detector
+	slots     chan struct{} //in flight and queued detections
+	wait      time.Duration
+	size      int
+	batchSize int
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPool loads size detectors using load. At most queueSize detections will wait for a detector, for no longer than
+// wait, where a wait of zero or less waits indefinitely.
+func NewPool(size, queueSize int, wait time.Duration, load func() (Detector, error)) (*Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &Pool{
+		detectors: make(chan Detector, size),
+		slots:     make(chan struct{}, size+queueSize),
+		wait:      wait,
+		done:      make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		d, err := load()
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.detectors <- d
+		p.size++
+		p.batchSize = 1
+		if bd, ok := d.(BatchDetector); ok {
+			p.batchSize = bd.BatchSize()
+		}
+	}
+	return p, nil
+}
+
+// Size returns the number of detectors in the pool
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// Wait returns the maximum duration a detection waits for a detector
+func (p *Pool) Wait() time.Duration {
+	return p.wait
+}
+
+func (p *Pool) Detect(img image.Image) ([]*Detection, error) {
+	return p.DetectCustom(img, DefaultThresh, DefaultHierThresh, DefaultNMS)
+}
+
+func (p *Pool) DetectCustom(img image.Image, thresh, hierThresh, nms float32) ([]*Detection, error) {
+	d, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(d)
+	return d.DetectCustom(img, thresh, hierThresh, nms)
+}
+
+// DetectBatch runs imgs as a single batch on one of the detectors
+func (p *Pool) DetectBatch(imgs []image.Image, thresh, hierThresh, nms float32) ([][]*Detection, error) {
+	d, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(d)
+	return DetectBatch(d, imgs, thresh, hierThresh, nms)
+}
+
+// BatchSize returns the batch size of the pooled detectors
+func (p *Pool) BatchSize() int {
+	return p.batchSize
+}
+
+func (p *Pool) acquire() (Detector, error) {
+	select {
+	case <-p.done:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return nil, ErrPoolBusy
+	}
+
+	var timeout <-chan time.Time
+	if p.wait > 0 {
+		timer := time.NewTimer(p.wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case d := <-p.detectors:
+		return d, nil
+	case <-timeout:
+		<-p.slots
+		return nil, ErrPoolBusy
+	case <-p.done:
+		<-p.slots
+		return nil, ErrPoolClosed
+	}
+}
+
+func (p *Pool) release(d Detector) {
+	p.detectors <- d
+	<-p.slots
+}
+
+// Close rejects any new detections, waits for the detections in flight to finish and then closes every detector
+func (p *Pool) Close() (err error) {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		for i := 0; i < p.size; i++ {
+			if e := (<-p.detectors).Close(); e != nil {
+				err = e
+			}
+		}
+	})
+	return
+}
@@ -0,0 +1,99 @@
+package darknet
+
+import (
+	"github.com/stretchr/testify/require"
+	"image"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingDetector struct {
+	started chan struct{}
+	unblock chan struct{}
+	closed  bool
+}
+
+func (d *blockingDetector) Detect(img image.Image) ([]*Detection, error) {
+	return d.DetectCustom(img, DefaultThresh, DefaultHierThresh, DefaultNMS)
+}
+
+func (d *blockingDetector) DetectCustom(image.Image, float32, float32, float32) ([]*Detection, error) {
+	d.started <- struct{}{}
+	<-d.unblock
+	return []*Detection{{Confidence: 1}}, nil
+}
+
+func (d *blockingDetector) Close() error {
+	d.closed = true
+	return nil
+}
+
+func newBlockingPool(t *testing.T, size, queueSize int, wait time.Duration) (*Pool, []*blockingDetector, chan struct{}) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	var detectors []*blockingDetector
+	pool, err := NewPool(size, queueSize, wait, func() (Detector, error) {
+		d := &blockingDetector{started: started, unblock: unblock}
+		detectors = append(detectors, d)
+		return d, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, size, pool.Size())
+	return pool, detectors, started
+}
+
+func TestPool_Queue(t *testing.T) {
+	pool, detectors, started := newBlockingPool(t, 2, 1, 0)
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dets, err := pool.Detect(img)
+			require.NoError(t, err)
+			require.Len(t, dets, 1)
+		}()
+	}
+	<-started
+	<-started
+
+	//two detections in flight and one queued, so the queue is full
+	require.Eventually(t, func() bool {
+		return len(pool.slots) == 3
+	}, time.Second, time.Millisecond)
+	_, err := pool.Detect(img)
+	require.Equal(t, ErrPoolBusy, err)
+
+	close(detectors[0].unblock)
+	<-started
+	wg.Wait()
+
+	require.NoError(t, pool.Close())
+	for _, d := range detectors {
+		require.True(t, d.closed)
+	}
+	_, err = pool.Detect(img)
+	require.Equal(t, ErrPoolClosed, err)
+}
+
+func TestPool_Wait(t *testing.T) {
+	pool, detectors, started := newBlockingPool(t, 1, 1, 10*time.Millisecond)
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = pool.Detect(img)
+	}()
+	<-started
+
+	_, err := pool.Detect(img)
+	require.Equal(t, ErrPoolBusy, err)
+
+	close(detectors[0].unblock)
+	<-done
+	require.NoError(t, pool.Close())
+}
@@ -0,0 +1,248 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+const (
+	DefaultAnchors     = 6
+	DefaultInputWidth  = 416
+	DefaultInputHeight = 416
+
+	anchorIterations = 1000
+)
+
+// ErrTooFewBoxes is returned when the dataset has fewer labelled boxes than anchors to calculate
+var ErrTooFewBoxes = errors.New("too few labelled boxes")
+
+// ErrTooManyAnchors is returned when asked for more than MaxAnchors anchors
+var ErrTooManyAnchors = errors.New("too many anchors")
+
+// MaxAnchors is the most anchors calculated at once, well beyond the 9 anchors of yolov3 and yolov4
+const MaxAnchors = 30
+
+// Anchor is the width and height of a box in pixels of the network input
+type Anchor struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// AnchorReport are the anchors clustered from the labelled boxes of a dataset
+type AnchorReport struct {
+	Anchors []Anchor `json:"anchors"`
+	Value   string   `json:"value"`  //anchors as given to the [yolo] sections of a network config
+	AvgIoU  float64  `json:"avgIou"` //average IoU of each box with its closest anchor
+	Boxes   int      `json:"boxes"`
+	Width   int      `json:"width"`
+	Height  int      `json:"height"`
+	//images of the train list left out, like darknet detector calc_anchors does
+	MissingLabels []string `json:"missingLabels"` //images without a label file
+	InvalidLabels []string `json:"invalidLabels"` //images with a label file that can't be parsed
+}
+
+// Ints returns the anchors rounded to whole pixels, as darknet expects them
+func (r *AnchorReport) Ints() [][2]int {
+	ints := make([][2]int, len(r.Anchors))
+	for i, a := range r.Anchors {
+		ints[i] = [2]int{roundPixels(a.Width), roundPixels(a.Height)}
+	}
+	return ints
+}
+
+func roundPixels(v float64) int {
+	return int(math.Max(1, math.Round(v)))
+}
+
+// AnchorDefaults replaces the zero values of n, width and height with the number of anchors and the input size of the
+// network, or DefaultAnchors lacking a network. See InputSize.
+func AnchorDefaults(network *darknetcfg.Network, n, width, height int) (int, int, int, error) {
+	if network != nil && n == 0 {
+		if yolos := network.SectionsNamed("yolo"); len(yolos) > 0 {
+			var err error
+			n, err = yolos[0].GetInt("num", 0)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	}
+	if n == 0 {
+		n = DefaultAnchors
+	}
+	width, height, err := InputSize(network, width, height)
+	return n, width, height, err
+}
+
+// InputSize replaces the zero values of width and height with the input size of the network, or DefaultInputWidth x
+// DefaultInputHeight lacking a network
+func InputSize(network *darknetcfg.Network, width, height int) (int, int, error) {
+	var net *darknetcfg.Section
+	if network != nil {
+		net = network.Net()
+	}
+	var err error
+	if net != nil {
+		if width == 0 {
+			width, err = net.GetInt("width", 0)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		if height == 0 {
+			height, err = net.GetInt("height", 0)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if width == 0 {
+		width = DefaultInputWidth
+	}
+	if height == 0 {
+		height = DefaultInputHeight
+	}
+	return width, height, nil
+}
+
+// CalcAnchors clusters the labelled boxes of the train list of a data file into n anchors for a network input of
+// width x height, the equivalent of darknet detector calc_anchors. Images with a missing or invalid label file are
+// left out.
+func CalcAnchors(data *darknetcfg.DarknetData, base string, n, width, height int) (*AnchorReport, error) {
+	if n < 1 || width < 1 || height < 1 {
+		return nil, fmt.Errorf("the number of anchors and the input size must be positive, got %d anchors at %dx%d", n, width, height)
+	}
+	if n > MaxAnchors {
+		return nil, fmt.Errorf("%w, at most %d anchors can be calculated, got %d", ErrTooManyAnchors, MaxAnchors, n)
+	}
+	entries, err := ReadList(darknetcfg.Train, data.Get(darknetcfg.Train), base)
+	if err != nil {
+		return nil, err
+	}
+	r := &AnchorReport{Width: width, Height: height, MissingLabels: []string{}, InvalidLabels: []string{}}
+	var boxes []Anchor
+	for _, e := range entries {
+		labels, err := ReadLabels(e)
+		if errors.Is(err, os.ErrNotExist) {
+			r.MissingLabels = append(r.MissingLabels, e.Path)
+			continue
+		}
+		if err != nil {
+			r.InvalidLabels = append(r.InvalidLabels, e.Path)
+			continue
+		}
+		for _, l := range labels {
+			box := Anchor{Width: (l.X2 - l.X1) * float64(width), Height: (l.Y2 - l.Y1) * float64(height)}
+			if box.Width > 0 && box.Height > 0 {
+				boxes = append(boxes, box)
+			}
+		}
+	}
+
+	r.Anchors, r.AvgIoU, err = Anchors(boxes, n)
+	if err != nil {
+		return nil, err
+	}
+	r.Boxes = len(boxes)
+	for i, a := range r.Ints() {
+		if i > 0 {
+			r.Value += ", "
+		}
+		r.Value += fmt.Sprintf("%d,%d", a[0], a[1])
+	}
+	return r, nil
+}
+
+// Anchors clusters boxes into n anchors with k-means, using 1-IoU of boxes sharing a center as the distance. It returns
+// the anchors ordered by area, and the average IoU of each box with its closest anchor.
+func Anchors(boxes []Anchor, n int) ([]Anchor, float64, error) {
+	if n < 1 {
+		return nil, 0, fmt.Errorf("the number of anchors must be positive, got %d", n)
+	}
+	if len(boxes) < n {
+		return nil, 0, fmt.Errorf("%w, %d for %d anchors", ErrTooFewBoxes, len(boxes), n)
+	}
+
+	//k-means++ seeding with a fixed seed, the same dataset yields the same anchors
+	rnd := rand.New(rand.NewSource(1))
+	anchors := []Anchor{boxes[rnd.Intn(len(boxes))]}
+	distances := make([]float64, len(boxes))
+	for len(anchors) < n {
+		var sum float64
+		for i, b := range boxes {
+			_, iou := closest(b, anchors)
+			distances[i] = (1 - iou) * (1 - iou)
+			sum += distances[i]
+		}
+		next := boxes[rnd.Intn(len(boxes))]
+		for i, target := 0, rnd.Float64()*sum; sum > 0 && i < len(boxes); i++ {
+			if target -= distances[i]; target <= 0 {
+				next = boxes[i]
+				break
+			}
+		}
+		anchors = append(anchors, next)
+	}
+
+	assignments := make([]int, len(boxes))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	for iteration := 0; iteration < anchorIterations; iteration++ {
+		changed := false
+		for i, b := range boxes {
+			if c, _ := closest(b, anchors); c != assignments[i] {
+				assignments[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([]Anchor, n)
+		counts := make([]int, n)
+		for i, b := range boxes {
+			sums[assignments[i]].Width += b.Width
+			sums[assignments[i]].Height += b.Height
+			counts[assignments[i]]++
+		}
+		for c := range anchors {
+			//an anchor left without boxes stays where it is
+			if counts[c] > 0 {
+				anchors[c] = Anchor{Width: sums[c].Width / float64(counts[c]), Height: sums[c].Height / float64(counts[c])}
+			}
+		}
+	}
+
+	sort.Slice(anchors, func(i, j int) bool {
+		return anchors[i].Width*anchors[i].Height < anchors[j].Width*anchors[j].Height
+	})
+	var sum float64
+	for _, b := range boxes {
+		_, iou := closest(b, anchors)
+		sum += iou
+	}
+	return anchors, sum / float64(len(boxes)), nil
+}
+
+// closest returns the index and IoU of the anchor overlapping b the most
+func closest(b Anchor, anchors []Anchor) (int, float64) {
+	best, bestIoU := 0, -1.0
+	for i, a := range anchors {
+		if v := iou(b, a); v > bestIoU {
+			best, bestIoU = i, v
+		}
+	}
+	return best, bestIoU
+}
+
+// iou returns the intersection over union of two boxes sharing a center
+func iou(a, b Anchor) float64 {
+	intersection := math.Min(a.Width, b.Width) * math.Min(a.Height, b.Height)
+	return intersection / (a.Width*a.Height + b.Width*b.Height - intersection)
+}
@@ -0,0 +1,77 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnchors(t *testing.T) {
+	var boxes []Anchor
+	for _, center := range []Anchor{{100, 200}, {10, 12}, {40, 30}} {
+		for _, d := range []float64{-1, 0, 1} {
+			boxes = append(boxes, Anchor{Width: center.Width + d, Height: center.Height - d})
+		}
+	}
+	anchors, avgIoU, err := Anchors(boxes, 3)
+	require.NoError(t, err)
+	require.Equal(t, []Anchor{{10, 12}, {40, 30}, {100, 200}}, anchors)
+	require.True(t, avgIoU > 0.9, "avg IoU %f", avgIoU)
+
+	_, _, err = Anchors(boxes, 10)
+	require.Error(t, err)
+	_, _, err = Anchors(boxes, 0)
+	require.Error(t, err)
+}
+
+func TestCalcAnchors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anchors")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var train []string
+	for i := 0; i < 4; i++ {
+		train = append(train, fmt.Sprintf("0 0.5 0.5 0.1 0.2\n1 0.5 0.5 %f 0.5", 0.5+float64(i)/100))
+	}
+	data := writeDataset(t, dir, map[darknetcfg.DarknetDataKey][]string{
+		darknetcfg.Train: train,
+		//the valid list is left out
+		darknetcfg.Valid: {strings.Repeat("0 0.5 0.5 0.9 0.9\n", 10)},
+	})
+
+	//an image without a label file and one with an invalid label file are left out
+	require.NoError(t, os.Remove(filepath.Join(dir, "dataset", "train0.txt")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dataset", "train1.txt"), []byte("0 0.5 0.5"), 0644))
+
+	r, err := CalcAnchors(data, dir, 2, 100, 200)
+	require.NoError(t, err)
+	require.Equal(t, 4, r.Boxes)
+	require.Equal(t, [][2]int{{10, 40}, {53, 100}}, r.Ints())
+	require.Equal(t, "10,40, 53,100", r.Value)
+	require.True(t, r.AvgIoU > 0.95)
+	require.Equal(t, []string{"dataset/train0.jpg"}, r.MissingLabels)
+	require.Equal(t, []string{"dataset/train1.jpg"}, r.InvalidLabels)
+
+	_, err = CalcAnchors(data, dir, 0, 100, 200)
+	require.Error(t, err)
+	_, err = CalcAnchors(data, dir, MaxAnchors+1, 100, 200)
+	require.True(t, errors.Is(err, ErrTooManyAnchors))
+}
+
+func TestAnchorDefaults(t *testing.T) {
+	n, w, h, err := AnchorDefaults(nil, 0, 0, 320)
+	require.NoError(t, err)
+	require.Equal(t, []int{DefaultAnchors, DefaultInputWidth, 320}, []int{n, w, h})
+
+	network, err := darknetcfg.ReadNetwork(strings.NewReader("[net]\nwidth=608\nheight=416\n[convolutional]\n[yolo]\nnum=9"))
+	require.NoError(t, err)
+	n, w, h, err = AnchorDefaults(network, 0, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []int{9, 608, 416}, []int{n, w, h})
+}
@@ -0,0 +1,201 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Problem is what is wrong with an entry of a train or valid list
+type Problem string
+
+const (
+	MissingImage     Problem = "missing image"
+	UndecodableImage Problem = "undecodable image"
+	Duplicate        Problem = "duplicate"
+	MissingLabel     Problem = "missing label"
+	InvalidLabel     Problem = "invalid label"
+	OutOfRange       Problem = "out of range coordinates"
+	InvalidClass     Problem = "invalid class"
+)
+
+// Issue is a problem with an entry of a train or valid list
+type Issue struct {
+	Split   darknetcfg.DarknetDataKey `json:"split"`
+	Line    int                       `json:"line"`
+	Path    string                    `json:"path"`
+	Problem Problem                   `json:"problem"`
+	Detail  string                    `json:"detail,omitempty"`
+	entry   *Entry
+}
+
+func (i *Issue) String() string {
+	s := fmt.Sprintf("%s:%d %s: %s", i.Split, i.Line, i.Path, i.Problem)
+	if i.Detail != "" {
+		s += ", " + i.Detail
+	}
+	return s
+}
+
+// CheckReport are the issues found with the train and valid lists, and what was done about them if fixed
+type CheckReport struct {
+	Images      int      `json:"images"`
+	Issues      []*Issue `json:"issues"`
+	Removed     []string `json:"removed,omitempty"`     //entries removed from the lists by Fix
+	Quarantined []string `json:"quarantined,omitempty"` //files moved to the quarantine directory by Fix
+	entries     []*Entry
+}
+
+// Valid returns the entries without issues in the order they are listed
+func (r *CheckReport) Valid() []*Entry {
+	bad := map[*Entry]bool{}
+	for _, i := range r.Issues {
+		bad[i.entry] = true
+	}
+	var valid []*Entry
+	for _, e := range r.entries {
+		if !bad[e] {
+			valid = append(valid, e)
+		}
+	}
+	return valid
+}
+
+// Check checks every entry of the train and valid lists of a data file for missing or undecodable images, missing or
+// invalid labels, labels with coordinates out of range or class ids beyond the classes of the data file, and entries
+// listing an image of the same file name as an earlier entry, which can't share a training session snapshot. With
+// decode unset only the header of the images is decoded.
+func Check(data *darknetcfg.DarknetData, base string, decode bool) (*CheckReport, error) {
+	classes, err := Classes(data)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := Read(data, base)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &CheckReport{Images: len(entries), Issues: []*Issue{}, entries: entries}
+	report := func(e *Entry, problem Problem, detail string) {
+		r.Issues = append(r.Issues, &Issue{Split: e.Split, Line: e.Line, Path: e.Path, Problem: problem, Detail: detail, entry: e})
+	}
+	seen := map[string]*Entry{}
+	for _, e := range entries {
+		name := filepath.Base(e.Image.String())
+		if first, ok := seen[name]; ok {
+			report(e, Duplicate, fmt.Sprintf("of %s:%d", first.Split, first.Line))
+			continue
+		}
+		seen[name] = e
+
+		if err := checkImage(e.Image.String(), decode); errors.Is(err, os.ErrNotExist) {
+			report(e, MissingImage, "")
+		} else if err != nil {
+			report(e, UndecodableImage, err.Error())
+		}
+
+		labels, err := ReadLabels(e)
+		if errors.Is(err, os.ErrNotExist) {
+			report(e, MissingLabel, "")
+			continue
+		}
+		if err != nil {
+			report(e, InvalidLabel, errors.Unwrap(err).Error())
+			continue
+		}
+		var outOfRange, invalidClass []string
+		for i, l := range labels {
+			x, y, w, h := (l.X1+l.X2)/2, (l.Y1+l.Y2)/2, l.X2-l.X1, l.Y2-l.Y1
+			if x < 0 || x > 1 || y < 0 || y > 1 || w <= 0 || w > 1 || h <= 0 || h > 1 {
+				outOfRange = append(outOfRange, strconv.Itoa(i+1))
+			}
+			if l.Class < 0 || (classes > 0 && l.Class >= classes) {
+				invalidClass = append(invalidClass, strconv.Itoa(i+1))
+			}
+		}
+		if len(outOfRange) > 0 {
+			report(e, OutOfRange, "labels "+strings.Join(outOfRange, ","))
+		}
+		if len(invalidClass) > 0 {
+			report(e, InvalidClass, fmt.Sprintf("labels %s, %d classes", strings.Join(invalidClass, ","), classes))
+		}
+	}
+	return r, nil
+}
+
+func checkImage(fp string, decode bool) error {
+	fh, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if decode {
+		_, _, err = image.Decode(bufio.NewReader(fh))
+	} else {
+		_, _, err = image.DecodeConfig(bufio.NewReader(fh))
+	}
+	return err
+}
+
+// Fix removes the entries with issues from the train and valid lists and moves their images and labels to the
+// quarantine directory, along with the report as report.json. The files of duplicates are left in place, as the
+// earlier entry lists them.
+func Fix(data *darknetcfg.DarknetData, r *CheckReport, quarantineDir string) error {
+	if len(r.Issues) == 0 {
+		return nil
+	}
+	err := os.MkdirAll(quarantineDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var remove []*Entry
+	quarantine := map[*Entry]bool{}
+	for _, i := range r.Issues {
+		if _, ok := quarantine[i.entry]; !ok {
+			remove = append(remove, i.entry)
+			r.Removed = append(r.Removed, fmt.Sprintf("%s:%d %s", i.Split, i.Line, i.Path))
+		}
+		quarantine[i.entry] = quarantine[i.entry] || i.Problem != Duplicate
+	}
+
+	if err := RemoveEntries(data, remove); err != nil {
+		return err
+	}
+	for _, e := range r.entries {
+		if !quarantine[e] {
+			continue
+		}
+		for _, f := range []string{e.Image.String(), e.Label()} {
+			dst := filepath.Join(quarantineDir, filepath.Base(f))
+			if _, err := os.Stat(dst); err == nil {
+				dst = filepath.Join(quarantineDir, fmt.Sprintf("%s.%d.%s", e.Split, e.Line, filepath.Base(f)))
+			}
+			err := os.Rename(f, dst)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			r.Quarantined = append(r.Quarantined, dst)
+		}
+	}
+
+	buf, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(quarantineDir, "report.json"), buf, 0644)
+}
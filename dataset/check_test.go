@@ -0,0 +1,89 @@
+package dataset
+
+import (
+	"bytes"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data := writeDataset(t, dir, map[darknetcfg.DarknetDataKey][]string{
+		darknetcfg.Train: {
+			"0 0.5 0.5 0.1 0.1",
+			"1 0.5 0.5 0.1 0.1",
+			"0 0.5 0.5 0.1",
+			"0 1.5 0.5 0.1 0.1\n2 0.5 0.5 0.1 0.1\n1 0.5 0.5 0.2 0",
+			"",
+			"0 0.5 0.5 0.1 0.1",
+		},
+		darknetcfg.Valid: {"0 0.5 0.5 0.1 0.1"},
+	})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "names.txt"), []byte("circle\nrectangle"), 0644))
+	img := &bytes.Buffer{}
+	require.NoError(t, png.Encode(img, image.NewGray(image.Rect(0, 0, 4, 4))))
+	for _, name := range []string{"train0", "train2", "train3", "train4", "train5", "valid0"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dataset", name+".jpg"), img.Bytes(), 0644))
+	}
+	//train1 lacks its image, train4 lacks its label and train5 is truncated
+	require.NoError(t, os.Remove(filepath.Join(dir, "dataset", "train4.txt")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dataset", "train5.jpg"), img.Bytes()[:len(img.Bytes())/2], 0644))
+	//the valid list repeats train0
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "valid.txt"), []byte("dataset/valid0.jpg\n\ndataset/train0.jpg\n"), 0644))
+
+	r, err := Check(data, dir, true)
+	require.NoError(t, err)
+	require.Equal(t, 8, r.Images)
+	var issues []string
+	for _, i := range r.Issues {
+		issues = append(issues, i.String())
+	}
+	require.Equal(t, []string{
+		"train:2 dataset/train1.jpg: missing image",
+		"train:3 dataset/train2.jpg: invalid label, incorrect format",
+		"train:4 dataset/train3.jpg: out of range coordinates, labels 1,3",
+		"train:4 dataset/train3.jpg: invalid class, labels 2, 2 classes",
+		"train:5 dataset/train4.jpg: missing label",
+		"train:6 dataset/train5.jpg: undecodable image, png: invalid format: not enough pixel data",
+		"valid:3 dataset/train0.jpg: duplicate, of train:1",
+	}, issues)
+	var valid []string
+	for _, e := range r.Valid() {
+		valid = append(valid, e.Path)
+	}
+	require.Equal(t, []string{"dataset/train0.jpg", "dataset/valid0.jpg"}, valid)
+
+	//only the header is decoded unless asked to decode
+	r, err = Check(data, dir, false)
+	require.NoError(t, err)
+	require.Len(t, r.Issues, 6)
+
+	quarantine := filepath.Join(dir, "quarantine")
+	require.NoError(t, Fix(data, r, quarantine))
+	require.Len(t, r.Removed, 5)
+	train, err := ioutil.ReadFile(filepath.Join(dir, "train.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "dataset/train0.jpg\ndataset/train5.jpg\n", string(train))
+	valid2, err := ioutil.ReadFile(filepath.Join(dir, "valid.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "dataset/valid0.jpg\n\n", string(valid2))
+	for _, f := range []string{"train1.txt", "train2.jpg", "train2.txt", "train3.jpg", "train3.txt", "train4.jpg", "report.json"} {
+		require.FileExists(t, filepath.Join(quarantine, f))
+	}
+	require.FileExists(t, filepath.Join(dir, "dataset", "train0.jpg"), "duplicates are left in place")
+	_, err = os.Stat(filepath.Join(dir, "dataset", "train3.jpg"))
+	require.True(t, os.IsNotExist(err))
+
+	r, err = Check(data, dir, false)
+	require.NoError(t, err)
+	require.Empty(t, r.Issues)
+}
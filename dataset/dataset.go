@@ -0,0 +1,175 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Splits are the lists of a data file an image is trained or validated with
+var Splits = []darknetcfg.DarknetDataKey{darknetcfg.Train, darknetcfg.Valid}
+
+// Entry is an image listed in the train or valid list of a data file
+type Entry struct {
+	Split darknetcfg.DarknetDataKey //list the image is listed in
+	Line  int                       //line of the list, starting at 1
+	Path  string                    //path as listed
+	Image darknetcfg.DarknetInputFile
+}
+
+// ID returns the file name of the image without extension, the md5 sum of the image for images stored by the label
+// endpoint
+func (e *Entry) ID() string {
+	name := filepath.Base(e.Image.String())
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Label returns the path of the yolo label file of the image
+func (e *Entry) Label() string {
+	return e.Image.StringTxt()
+}
+
+// ReadList reads the images listed in a train or valid list. Relative paths are resolved against base, the storage
+// directory the label endpoint lists images relative to.
+func ReadList(split darknetcfg.DarknetDataKey, file, base string) ([]*Entry, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	scanner := bufio.NewScanner(bytes.NewBuffer(buf))
+	for line := 1; scanner.Scan(); line++ {
+		p := strings.TrimSpace(scanner.Text())
+		if p == "" {
+			continue
+		}
+		fp := p
+		if !filepath.IsAbs(fp) {
+			fp = filepath.Join(base, fp)
+		}
+		entries = append(entries, &Entry{
+			Split: split,
+			Line:  line,
+			Path:  p,
+			Image: darknetcfg.DarknetInputFile(fp),
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// Read reads the images listed in the train and valid lists of a data file, the train list first. Lists missing from
+// the data file are skipped.
+func Read(data *darknetcfg.DarknetData, base string) ([]*Entry, error) {
+	var entries []*Entry
+	for _, split := range Splits {
+		file := data.Get(split)
+		if file == "" {
+			continue
+		}
+		e, err := ReadList(split, file, base)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e...)
+	}
+	return entries, nil
+}
+
+// ReadLabels reads the yolo label file of an entry, the coordinates of the labels are relative to the image size
+func ReadLabels(e *Entry) (darknet.Labels, error) {
+	labels, err := darknet.ParseLabelFile(image.Rect(0, 0, 1, 1), e.Label())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Label(), err)
+	}
+	return labels, nil
+}
+
+// WriteLabels replaces the yolo label file of an entry, the coordinates of the labels are relative to size
+func WriteLabels(e *Entry, size image.Rectangle, labels darknet.Labels) error {
+	return writeFile(e.Label(), []byte(labels.Yolo(size)))
+}
+
+// RemoveEntries removes entries from the train and valid lists of a data file
+func RemoveEntries(data *darknetcfg.DarknetData, entries []*Entry) error {
+	lines := map[darknetcfg.DarknetDataKey]map[int]bool{}
+	for _, e := range entries {
+		if lines[e.Split] == nil {
+			lines[e.Split] = map[int]bool{}
+		}
+		lines[e.Split][e.Line] = true
+	}
+	for _, split := range Splits {
+		if lines[split] == nil {
+			continue
+		}
+		if err := removeLines(data.Get(split), lines[split]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeLines rewrites a list without the given lines, counting from 1
+func removeLines(file string, lines map[int]bool) error {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	out := &bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewBuffer(buf))
+	for line := 1; scanner.Scan(); line++ {
+		if !lines[line] {
+			out.WriteString(scanner.Text() + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return writeFile(file, out.Bytes())
+}
+
+// writeFile replaces a file atomically by renaming a temporary file of the same directory
+func writeFile(file string, buf []byte) error {
+	fh, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(buf)
+	if e := fh.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(fh.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+	}
+	return err
+}
+
+// ValidateLabels checks that labels in pixels lie within size and have a class id below classes, unless classes is zero
+func ValidateLabels(labels darknet.Labels, size image.Rectangle, classes int) error {
+	bounds := image.Rect(0, 0, size.Dx(), size.Dy())
+	for i, l := range labels {
+		if l == nil {
+			return fmt.Errorf("label %d is null", i+1)
+		}
+		if l.X1 >= l.X2 || l.Y1 >= l.Y2 || l.X1 < 0 || l.Y1 < 0 || l.X2 > float64(bounds.Max.X) || l.Y2 > float64(bounds.Max.Y) {
+			return fmt.Errorf("label %d (%g,%g)-(%g,%g) is not within the %dx%d image", i+1, l.X1, l.Y1, l.X2, l.Y2, bounds.Dx(), bounds.Dy())
+		}
+		if l.Class < 0 || (classes > 0 && l.Class >= classes) {
+			return fmt.Errorf("label %d has the invalid class %d of %d classes", i+1, l.Class, classes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package dataset
+
+import (
+	"fmt"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDataset writes a data file with a train and valid list of images labelled by labels, listed relative to dir
+// like the label endpoint lists them. The images themselves are not written.
+func writeDataset(t *testing.T, dir string, labels map[darknetcfg.DarknetDataKey][]string) *darknetcfg.DarknetData {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "dataset"), 0755))
+	for _, split := range Splits {
+		var list []string
+		for i, l := range labels[split] {
+			name := fmt.Sprintf("dataset/%s%d", split, i)
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".txt"), []byte(l), 0644))
+			list = append(list, name+".jpg")
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, string(split)+".txt"), []byte(strings.Join(list, "\n")), 0644))
+	}
+	fp := filepath.Join(dir, "dataset.cfg")
+	require.NoError(t, ioutil.WriteFile(fp, []byte("classes = 2\ntrain = train.txt\nvalid = valid.txt\nnames = names.txt"), 0644))
+	data, err := darknetcfg.ReadDataFile(fp)
+	require.NoError(t, err)
+	return data
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data := writeDataset(t, dir, map[darknetcfg.DarknetDataKey][]string{
+		darknetcfg.Train: {"0 0.5 0.5 0.2 0.2\n1 0.1 0.1 0.1 0.1", ""},
+		darknetcfg.Valid: {"1 0.5 0.5 0.5 0.5"},
+	})
+	entries, err := Read(data, dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, darknetcfg.Train, entries[1].Split)
+	require.Equal(t, 2, entries[1].Line)
+	require.Equal(t, "dataset/train1.jpg", entries[1].Path)
+	require.Equal(t, filepath.Join(dir, "dataset", "train1.txt"), entries[1].Label())
+	require.Equal(t, darknetcfg.Valid, entries[2].Split)
+
+	labels, err := ReadLabels(entries[0])
+	require.NoError(t, err)
+	require.Len(t, labels, 2)
+	require.InDelta(t, 0.4, labels[0].X1, 1e-9)
+	labels, err = ReadLabels(entries[1])
+	require.NoError(t, err)
+	require.Empty(t, labels)
+
+	data.Set(darknetcfg.Train, "missing.txt")
+	_, err = Read(data, dir)
+	require.Error(t, err)
+}
@@ -0,0 +1,189 @@
+package dataset
+
+import (
+	"errors"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sizeBuckets are the lower bounds of the histogram of box sizes, the square root of the area in pixels of the input
+var sizeBuckets = []float64{0, 8, 16, 32, 64, 128, 256, 512}
+
+// aspectRatioBuckets are the lower bounds of the histogram of the width divided by the height of boxes
+var aspectRatioBuckets = []float64{0, 0.25, 0.5, 1, 2, 4}
+
+// Stats describe what has been labelled in the train and valid lists of a data file
+type Stats struct {
+	Width        int                                       `json:"width"`  //network input width the boxes are scaled to
+	Height       int                                       `json:"height"` //network input height the boxes are scaled to
+	Splits       map[darknetcfg.DarknetDataKey]*SplitStats `json:"splits"`
+	Classes      []*ClassStats                             `json:"classes"`
+	Sizes        []*Bucket                                 `json:"sizes"`        //square root of the area of the boxes in pixels
+	AspectRatios []*Bucket                                 `json:"aspectRatios"` //width divided by height of the boxes
+}
+
+// SplitStats are the image counts of the train or valid list
+type SplitStats struct {
+	Images         int      `json:"images"`
+	Boxes          int      `json:"boxes"`
+	Unlabelled     []string `json:"unlabelled"`     //images with an empty label file
+	MissingLabels  []string `json:"missingLabels"`  //images without a label file
+	InvalidLabels  []string `json:"invalidLabels"`  //images with a label file that can't be parsed
+	InvalidClasses []string `json:"invalidClasses"` //images with labels of class ids beyond the classes of the data file
+}
+
+// ClassStats are the instances of a class in the train and valid lists
+type ClassStats struct {
+	ID         int     `json:"id"`
+	Name       string  `json:"name"`
+	Train      int     `json:"train"`
+	Valid      int     `json:"valid"`
+	ValidShare float64 `json:"validShare"` //share of the instances in the valid list
+}
+
+// Bucket counts the boxes from Min up to Max, the last bucket of a histogram has no upper bound and a zero Max
+type Bucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max,omitempty"`
+	Count int     `json:"count"`
+}
+
+// ReadNames reads the class names of a names file, skipping blank lines
+func ReadNames(file string) ([]string, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Classes returns the number of classes of a data file, counting the names of its names file if it has one
+func Classes(data *darknetcfg.DarknetData) (int, error) {
+	if file := data.Get(darknetcfg.Names); file != "" {
+		names, err := ReadNames(file)
+		if err != nil {
+			return 0, err
+		}
+		return len(names), nil
+	}
+	if v := data.Get(darknetcfg.Classes); v != "" {
+		return strconv.Atoi(v)
+	}
+	return 0, nil
+}
+
+// CalcStats walks the train and valid lists of a data file and reports the labelled images and boxes, the boxes are
+// scaled to a network input of width x height. Boxes of class ids beyond the classes of the data file are left out of
+// the class counts.
+func CalcStats(data *darknetcfg.DarknetData, base string, width, height int) (*Stats, error) {
+	var names []string
+	if file := data.Get(darknetcfg.Names); file != "" {
+		var err error
+		names, err = ReadNames(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	classes, err := Classes(data)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := Read(data, base)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stats{
+		Width:        width,
+		Height:       height,
+		Splits:       map[darknetcfg.DarknetDataKey]*SplitStats{},
+		Sizes:        histogram(sizeBuckets),
+		AspectRatios: histogram(aspectRatioBuckets),
+	}
+	for _, split := range Splits {
+		s.Splits[split] = &SplitStats{Unlabelled: []string{}, MissingLabels: []string{}, InvalidLabels: []string{}, InvalidClasses: []string{}}
+	}
+	s.Classes = make([]*ClassStats, classes)
+	for i := range s.Classes {
+		s.Classes[i] = &ClassStats{ID: i}
+		if i < len(names) {
+			s.Classes[i].Name = names[i]
+		}
+	}
+
+	for _, e := range entries {
+		split := s.Splits[e.Split]
+		split.Images++
+		labels, err := ReadLabels(e)
+		if errors.Is(err, os.ErrNotExist) {
+			split.MissingLabels = append(split.MissingLabels, e.Path)
+			continue
+		}
+		if err != nil {
+			split.InvalidLabels = append(split.InvalidLabels, e.Path)
+			continue
+		}
+		if len(labels) == 0 {
+			split.Unlabelled = append(split.Unlabelled, e.Path)
+			continue
+		}
+
+		invalidClass := false
+		for _, l := range labels {
+			split.Boxes++
+			switch {
+			case l.Class < 0 || l.Class >= classes:
+				invalidClass = true
+			case e.Split == darknetcfg.Valid:
+				s.Classes[l.Class].Valid++
+			default:
+				s.Classes[l.Class].Train++
+			}
+
+			w, h := (l.X2-l.X1)*float64(width), (l.Y2-l.Y1)*float64(height)
+			count(s.Sizes, math.Sqrt(math.Max(w*h, 0)))
+			if h > 0 {
+				count(s.AspectRatios, w/h)
+			}
+		}
+		if invalidClass {
+			split.InvalidClasses = append(split.InvalidClasses, e.Path)
+		}
+	}
+	for _, c := range s.Classes {
+		if total := c.Train + c.Valid; total > 0 {
+			c.ValidShare = float64(c.Valid) / float64(total)
+		}
+	}
+	return s, nil
+}
+
+func histogram(bounds []float64) []*Bucket {
+	buckets := make([]*Bucket, len(bounds))
+	for i, min := range bounds {
+		buckets[i] = &Bucket{Min: min}
+		if i+1 < len(bounds) {
+			buckets[i].Max = bounds[i+1]
+		}
+	}
+	return buckets
+}
+
+func count(buckets []*Bucket, v float64) {
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if v >= buckets[i].Min {
+			buckets[i].Count++
+			return
+		}
+	}
+}
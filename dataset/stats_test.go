@@ -0,0 +1,75 @@
+package dataset
+
+import (
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCalcStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data := writeDataset(t, dir, map[darknetcfg.DarknetDataKey][]string{
+		darknetcfg.Train: {"0 0.5 0.5 0.1 0.1\n1 0.5 0.5 0.5 0.125", "", "0 0.5 0.5", "0 0.5 0.5 0.8 0.8\n2 0.5 0.5 0.1 0.1"},
+		darknetcfg.Valid: {"1 0.5 0.5 0.5 0.5"},
+	})
+	require.NoError(t, os.Remove(filepath.Join(dir, "dataset", "valid0.txt")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "valid.txt"), []byte("dataset/valid0.jpg\ndataset/valid1.jpg"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dataset", "valid1.txt"), []byte("1 0.5 0.5 0.2 0.2"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "names.txt"), []byte("circle\nrectangle\n"), 0644))
+
+	s, err := CalcStats(data, dir, 320, 160)
+	require.NoError(t, err)
+
+	train := s.Splits[darknetcfg.Train]
+	require.Equal(t, 4, train.Images)
+	require.Equal(t, 4, train.Boxes)
+	require.Equal(t, []string{"dataset/train1.jpg"}, train.Unlabelled)
+	require.Equal(t, []string{"dataset/train2.jpg"}, train.InvalidLabels)
+	require.Equal(t, []string{"dataset/train3.jpg"}, train.InvalidClasses)
+	valid := s.Splits[darknetcfg.Valid]
+	require.Equal(t, 2, valid.Images)
+	require.Equal(t, []string{"dataset/valid0.jpg"}, valid.MissingLabels)
+
+	require.Equal(t, []*ClassStats{
+		{ID: 0, Name: "circle", Train: 2},
+		{ID: 1, Name: "rectangle", Train: 1, Valid: 1, ValidShare: 0.5},
+	}, s.Classes)
+
+	//boxes of 32x16, 160x20, 256x128, 32x16 and 64x32 pixels
+	sizes := map[float64]int{}
+	for _, b := range s.Sizes {
+		sizes[b.Min] = b.Count
+	}
+	require.Equal(t, map[float64]int{0: 0, 8: 0, 16: 2, 32: 2, 64: 0, 128: 1, 256: 0, 512: 0}, sizes)
+	ratios := map[float64]int{}
+	for _, b := range s.AspectRatios {
+		ratios[b.Min] = b.Count
+	}
+	require.Equal(t, map[float64]int{0: 0, 0.25: 0, 0.5: 0, 1: 0, 2: 4, 4: 1}, ratios)
+	require.Zero(t, s.Sizes[len(s.Sizes)-1].Max)
+
+	//class ids are not counted beyond the classes of the data file, however large
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dataset", "train0.txt"), []byte("2147483647 0.5 0.5 0.1 0.1"), 0644))
+	s, err = CalcStats(data, dir, 320, 160)
+	require.NoError(t, err)
+	require.Len(t, s.Classes, 2)
+	require.Equal(t, []string{"dataset/train0.jpg", "dataset/train3.jpg"}, s.Splits[darknetcfg.Train].InvalidClasses)
+}
+
+func TestReadNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "names")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "names.txt")
+	require.NoError(t, ioutil.WriteFile(fp, []byte("circle\r\n\nrectangle\n"), 0644))
+	names, err := ReadNames(fp)
+	require.NoError(t, err)
+	require.Equal(t, []string{"circle", "rectangle"}, names)
+}
@@ -0,0 +1,156 @@
+package dataset
+
+import (
+	"fmt"
+	"github.com/gofrs/flock"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Upload is an image to add to the dataset along with its labels in pixels
+type Upload struct {
+	ID     string //md5 sum of the image, naming its files
+	Format string //image format, the extension of the image file
+	Image  []byte
+	Size   image.Rectangle
+	Labels darknet.Labels
+}
+
+// Writer makes the changes to the train and valid lists of the data file and the images and labels they list one at a
+// time, within the process by a mutex and across processes, such as the dataset check and train commands, by a lock
+// file in the storage directory
+type Writer struct {
+	config *cfg.AppConfig
+	mu     sync.Mutex
+	lock   *flock.Flock
+}
+
+func NewWriter(config *cfg.AppConfig) *Writer {
+	return &Writer{
+		config: config,
+		lock:   config.LockDataset(),
+	}
+}
+
+// Lock waits for the changes of other writers to finish and returns a func ending the changes of the caller
+func (w *Writer) Lock() (unlock func(), err error) {
+	w.mu.Lock()
+	err = w.lock.Lock()
+	if err != nil {
+		w.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		_ = w.lock.Unlock()
+		w.mu.Unlock()
+	}, nil
+}
+
+// Add stores images in the dataset directory along with their labels, and lists the images not listed already in the
+// train or valid list, keeping the share of the valid list at the dataset split. The lists are counted while locked,
+// so the split holds however many writers add images. An image listed already keeps its split and has its labels
+// replaced. The entries of the images are returned in the order of the uploads.
+func (w *Writer) Add(uploads []*Upload) ([]*Entry, error) {
+	unlock, err := w.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	data, err := darknetcfg.ReadDataFile(w.config.DataFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, split := range Splits {
+		if data.Get(split) == "" {
+			return nil, fmt.Errorf("the data file lacks a %s list", split)
+		}
+	}
+	entries := map[string]*Entry{}
+	counts := map[darknetcfg.DarknetDataKey]int{}
+	for _, split := range Splits {
+		listed, err := ReadList(split, data.Get(split), w.config.Storage)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, e := range listed {
+			if _, ok := entries[e.ID()]; !ok {
+				entries[e.ID()] = e
+			}
+		}
+		counts[split] = len(listed)
+	}
+
+	err = os.MkdirAll(w.config.DatasetPath(), 0755)
+	if err != nil {
+		return nil, err
+	}
+	added := make([]*Entry, len(uploads))
+	lines := map[darknetcfg.DarknetDataKey][]string{}
+	for i, u := range uploads {
+		e := entries[u.ID]
+		if e == nil {
+			fp := filepath.Join(w.config.DatasetPath(), u.ID+"."+u.Format)
+			p, err := filepath.Rel(w.config.Storage, fp)
+			if err != nil {
+				return nil, err
+			}
+			split := nextSplit(counts[darknetcfg.Train], counts[darknetcfg.Valid], w.config.DatasetSplit)
+			counts[split]++
+			e = &Entry{Split: split, Path: p, Image: darknetcfg.DarknetInputFile(fp)}
+			entries[u.ID] = e
+
+			err = writeFile(fp, u.Image)
+			if err != nil {
+				return nil, err
+			}
+			lines[split] = append(lines[split], p)
+		}
+		err = WriteLabels(e, u.Size, u.Labels)
+		if err != nil {
+			return nil, err
+		}
+		added[i] = e
+	}
+
+	//the images are listed once they and their labels are in place
+	for _, split := range Splits {
+		if len(lines[split]) == 0 {
+			continue
+		}
+		err = appendLines(data.Get(split), lines[split])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// nextSplit returns the list to add an image to, the valid list as long as it stays within the share given by split
+func nextSplit(train, valid int, split float64) darknetcfg.DarknetDataKey {
+	if float64(valid+1) <= split*float64(train+valid+1) {
+		return darknetcfg.Valid
+	}
+	return darknetcfg.Train
+}
+
+// appendLines replaces a list with a copy with lines appended, terminating the last line of the list first if need be
+func appendLines(list string, lines []string) error {
+	buf, err := ioutil.ReadFile(list)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	for _, l := range lines {
+		buf = append(buf, l+"\n"...)
+	}
+	return writeFile(list, buf)
+}
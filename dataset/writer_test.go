@@ -0,0 +1,104 @@
+package dataset
+
+import (
+	"fmt"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/darknetcfg"
+	"github.com/stretchr/testify/require"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriter_Add(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data := writeDataset(t, dir, nil)
+	config := &cfg.AppConfig{
+		NeuralNetworkConfig: &cfg.NeuralNetworkConfig{DataFile: filepath.Join(dir, "dataset.cfg")},
+		Storage:             dir,
+		DatasetSplit:        0.1,
+	}
+	upload := func(i int) *Upload {
+		return &Upload{
+			ID:     fmt.Sprintf("image%d", i),
+			Format: "png",
+			Image:  []byte{byte(i)},
+			Size:   image.Rect(0, 0, 10, 10),
+			Labels: darknet.Labels{{X1: 0, Y1: 0, X2: 5, Y2: 5, Class: i % 2}},
+		}
+	}
+
+	//writers of their own lock file like writers of separate processes
+	writers := []*Writer{NewWriter(config), NewWriter(config)}
+	errs := make([]error, 40)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = writers[i%len(writers)].Add([]*Upload{upload(i)})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	entries, err := Read(data, dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 40)
+	splits := map[darknetcfg.DarknetDataKey]int{}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		require.False(t, seen[e.ID()], "%s is listed more than once", e.ID())
+		seen[e.ID()] = true
+		splits[e.Split]++
+		require.FileExists(t, e.Image.String())
+		labels, err := ReadLabels(e)
+		require.NoError(t, err)
+		require.Len(t, labels, 1)
+	}
+	require.Equal(t, 4, splits[darknetcfg.Valid])
+	tmp, err := filepath.Glob(filepath.Join(dir, "*", "*.tmp"))
+	require.NoError(t, err)
+	require.Empty(t, tmp)
+
+	//an image listed already keeps its split and has its labels replaced
+	u := upload(0)
+	u.Labels = darknet.Labels{}
+	added, err := writers[0].Add([]*Upload{u, upload(40)})
+	require.NoError(t, err)
+	for _, e := range entries {
+		if e.ID() == "image0" {
+			require.Equal(t, e.Split, added[0].Split)
+		}
+	}
+	labels, err := ReadLabels(added[0])
+	require.NoError(t, err)
+	require.Empty(t, labels)
+	require.Equal(t, darknetcfg.Train, added[1].Split)
+	entries, err = Read(data, dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 41)
+}
+
+func TestNextSplit(t *testing.T) {
+	var train, valid int
+	for i := 0; i < 100; i++ {
+		if nextSplit(train, valid, 0.2) == darknetcfg.Valid {
+			valid++
+		} else {
+			train++
+		}
+		require.InDelta(t, 0.2*float64(train+valid), float64(valid), 1)
+	}
+	require.Equal(t, 20, valid)
+	require.Equal(t, darknetcfg.Train, nextSplit(0, 0, 0))
+}
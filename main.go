@@ -1,14 +1,21 @@
 package main
 
 import (
+	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/cmd/anchors"
+	datasetcmd "github.com/netbrain/darknetw/cmd/dataset"
 	"github.com/netbrain/darknetw/cmd/generate"
 	"github.com/netbrain/darknetw/cmd/serve"
 	"github.com/netbrain/darknetw/cmd/train"
 	"github.com/netbrain/darknetw/cmd/validate"
+	"github.com/netbrain/darknetw/darknet"
+	_ "github.com/netbrain/darknetw/darknet/fake" //registers the fake backend
+	"github.com/netbrain/darknetw/dataset"
 	"log"
 	"os"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -27,7 +34,7 @@ func main() {
 				Name:   "serve",
 				Usage:  "serve the darknetw api service",
 				Action: serveAction,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:    "host",
 						Usage:   "http host",
@@ -64,18 +71,96 @@ func main() {
 						EnvVars:  []string{"DARKNETW_STORAGE"},
 						Required: false,
 					},
-				},
+					&cli.StringFlag{
+						Name:    "backend",
+						Usage:   fmt.Sprintf("darknet backend implementation %v", darknet.Backends()),
+						EnvVars: []string{"DARKNETW_BACKEND"},
+						Value:   darknet.DefaultBackend,
+					},
+					&cli.Float64Flag{
+						Name:    "thresh",
+						Usage:   "default detection threshold (0.0 - 1.0)",
+						EnvVars: []string{"DARKNETW_NN_THRESH"},
+						Value:   darknet.DefaultThresh,
+					},
+					&cli.Float64Flag{
+						Name:    "hier-thresh",
+						Usage:   "default hierarchical detection threshold (0.0 - 1.0)",
+						EnvVars: []string{"DARKNETW_NN_HIER_THRESH"},
+						Value:   darknet.DefaultHierThresh,
+					},
+					&cli.Float64Flag{
+						Name:    "nms",
+						Usage:   "default non-maximum suppression threshold (0.0 - 1.0, 0 disables nms)",
+						EnvVars: []string{"DARKNETW_NN_NMS"},
+						Value:   darknet.DefaultNMS,
+					},
+					&cli.BoolFlag{
+						Name:    "pre-resize",
+						Usage:   "resize images to the network input size in go before handing them to darknet",
+						EnvVars: []string{"DARKNETW_NN_PRE_RESIZE"},
+						Value:   false,
+					},
+					&cli.IntFlag{
+						Name:    "pool-size",
+						Usage:   "number of networks loaded for concurrent inference",
+						EnvVars: []string{"DARKNETW_NN_POOL_SIZE"},
+						Value:   1,
+					},
+					&cli.IntFlag{
+						Name:    "pool-queue",
+						Usage:   "number of images allowed to wait for a network, exceeding requests are rejected with 503",
+						EnvVars: []string{"DARKNETW_NN_POOL_QUEUE"},
+						Value:   16,
+					},
+					&cli.DurationFlag{
+						Name:    "pool-wait",
+						Usage:   "maximum duration an image waits for a network before being rejected with 503",
+						EnvVars: []string{"DARKNETW_NN_POOL_WAIT"},
+						Value:   30 * time.Second,
+					},
+					&cli.IntFlag{
+						Name:    "batch-size",
+						Usage:   "number of images detected in a single pass through a network, images are batched across parts and requests",
+						EnvVars: []string{"DARKNETW_NN_BATCH_SIZE"},
+						Value:   1,
+					},
+					&cli.DurationFlag{
+						Name:    "batch-window",
+						Usage:   "maximum duration an image waits for a batch to fill up",
+						EnvVars: []string{"DARKNETW_NN_BATCH_WINDOW"},
+						Value:   10 * time.Millisecond,
+					},
+					&cli.DurationFlag{
+						Name:    "watch-interval",
+						Usage:   "poll the config, weights and data files at this interval and reload the model when they change (0 disables)",
+						EnvVars: []string{"DARKNETW_NN_WATCH_INTERVAL"},
+						Value:   0,
+					},
+					&cli.StringFlag{
+						Name:     "models",
+						Usage:    "json file of additional named models served at /api/v1/models/{name}, e.g. {\"coco\": {\"config\": \"...\", \"weights\": \"...\", \"data\": \"...\"}}",
+						EnvVars:  []string{"DARKNETW_MODELS"},
+						Required: false,
+					},
+					&cli.Int64Flag{
+						Name:    "models-memory",
+						Usage:   "memory budget in MiB of the loaded models, least recently used models are unloaded to stay within it (0 is unlimited)",
+						EnvVars: []string{"DARKNETW_MODELS_MEMORY"},
+						Value:   0,
+					},
+				}, trainingFlags()...),
 			},
 			{
 				Name:   "train",
 				Usage:  "train the neural network (equivalent of darknet detector train)",
 				Action: trainAction,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "config",
-						Usage:    "darknet config file",
+						Usage:    "darknet config file (required unless resuming)",
 						EnvVars:  []string{"DARKNETW_NN_CONFIG"},
-						Required: true,
+						Required: false, //checked by trainAction
 					},
 					&cli.StringFlag{
 						Name:     "weights",
@@ -85,9 +170,9 @@ func main() {
 					},
 					&cli.StringFlag{
 						Name:     "data",
-						Usage:    "darknet data file",
+						Usage:    "darknet data file (required unless resuming)",
 						EnvVars:  []string{"DARKNETW_NN_DATA"},
-						Required: true,
+						Required: false, //checked by trainAction
 					},
 					&cli.BoolFlag{
 						Name:    "clear",
@@ -95,12 +180,43 @@ func main() {
 						EnvVars: []string{"DARKNETW_NN_CLEAR"},
 						Value:   false,
 					},
+					&cli.StringFlag{
+						Name:     "resume",
+						Usage:    "id of an interrupted training session to resume from its latest weights, config and data are taken from the session",
+						Required: false,
+					},
 					&cli.StringFlag{
 						Name:     "storage",
 						Usage:    "input/output directory",
 						EnvVars:  []string{"DARKNETW_STORAGE"},
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:    "backend",
+						Usage:   fmt.Sprintf("darknet backend implementation %v", darknet.Backends()),
+						EnvVars: []string{"DARKNETW_BACKEND"},
+						Value:   darknet.DefaultBackend,
+					},
+				}, trainingFlags()...),
+				Subcommands: []*cli.Command{
+					{
+						Name:   "stop",
+						Usage:  "stop the running training session once the latest weights are saved",
+						Action: trainStopAction,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "storage",
+								Usage:    "input/output directory",
+								EnvVars:  []string{"DARKNETW_STORAGE"},
+								Required: false,
+							},
+							&cli.DurationFlag{
+								Name:  "wait",
+								Usage: "maximum duration to wait for the training to stop",
+								Value: 10 * time.Minute,
+							},
+						},
+					},
 				},
 			},
 			{
@@ -126,6 +242,123 @@ func main() {
 						EnvVars:  []string{"DARKNETW_NN_DATA"},
 						Required: true,
 					},
+					&cli.StringFlag{
+						Name:    "backend",
+						Usage:   fmt.Sprintf("darknet backend implementation %v", darknet.Backends()),
+						EnvVars: []string{"DARKNETW_BACKEND"},
+						Value:   darknet.DefaultBackend,
+					},
+				},
+			},
+			{
+				Name:   "anchors",
+				Usage:  "calculate the anchors of the [yolo] sections from the labelled dataset (equivalent of darknet detector calc_anchors)",
+				Action: anchorsAction,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "data",
+						Usage:    "darknet data file",
+						EnvVars:  []string{"DARKNETW_NN_DATA"},
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "config",
+						Usage:    "darknet config file, the defaults of --anchors, --width and --height are taken from it",
+						EnvVars:  []string{"DARKNETW_NN_CONFIG"},
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "storage",
+						Usage:    "input/output directory",
+						EnvVars:  []string{"DARKNETW_STORAGE"},
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:    "anchors",
+						Aliases: []string{"n"},
+						Usage:   fmt.Sprintf("number of anchors (defaults to num of the [yolo] sections of --config, or %d)", dataset.DefaultAnchors),
+					},
+					&cli.IntFlag{
+						Name:  "width",
+						Usage: fmt.Sprintf("network input width (defaults to the width of --config, or %d)", dataset.DefaultInputWidth),
+					},
+					&cli.IntFlag{
+						Name:  "height",
+						Usage: fmt.Sprintf("network input height (defaults to the height of --config, or %d)", dataset.DefaultInputHeight),
+					},
+					&cli.BoolFlag{
+						Name:  "write",
+						Usage: "write the anchors to the [yolo] sections of --config",
+						Value: false,
+					},
+				},
+			},
+			{
+				Name:  "dataset",
+				Usage: "inspect the labelled dataset",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "stats",
+						Usage:  "report the images, class instances and box sizes of the train and valid lists",
+						Action: datasetStatsAction,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "data",
+								Usage:    "darknet data file",
+								EnvVars:  []string{"DARKNETW_NN_DATA"},
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "config",
+								Usage:    "darknet config file, the defaults of --width and --height are taken from it",
+								EnvVars:  []string{"DARKNETW_NN_CONFIG"},
+								Required: false,
+							},
+							&cli.StringFlag{
+								Name:     "storage",
+								Usage:    "input/output directory",
+								EnvVars:  []string{"DARKNETW_STORAGE"},
+								Required: false,
+							},
+							&cli.IntFlag{
+								Name:  "width",
+								Usage: fmt.Sprintf("network input width the box sizes are relative to (defaults to the width of --config, or %d)", dataset.DefaultInputWidth),
+							},
+							&cli.IntFlag{
+								Name:  "height",
+								Usage: fmt.Sprintf("network input height the box sizes are relative to (defaults to the height of --config, or %d)", dataset.DefaultInputHeight),
+							},
+							&cli.BoolFlag{
+								Name:  "json",
+								Usage: "print the statistics as json",
+								Value: false,
+							},
+						},
+					},
+					{
+						Name:   "check",
+						Usage:  "check the train and valid lists for missing or undecodable images, missing or invalid labels and duplicates",
+						Action: datasetCheckAction,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "data",
+								Usage:    "darknet data file",
+								EnvVars:  []string{"DARKNETW_NN_DATA"},
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "storage",
+								Usage:    "input/output directory",
+								EnvVars:  []string{"DARKNETW_STORAGE"},
+								Required: false,
+							},
+							&cli.BoolFlag{
+								Name:  "fix",
+								Usage: "remove the entries with issues from the lists and move their files to the quarantine directory of the storage",
+								Value: false,
+							},
+						},
+					},
 				},
 			},
 			{
@@ -162,6 +395,42 @@ func main() {
 	}
 }
 
+// trainingFlags are the darknet training options, serve uses them as the defaults of training requests
+func trainingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntSliceFlag{
+			Name:    "gpus",
+			Usage:   "index of a gpu to train on, repeated for each gpu",
+			EnvVars: []string{"DARKNETW_NN_GPUS"},
+			Value:   cli.NewIntSlice(0),
+		},
+		&cli.BoolFlag{
+			Name:    "calc-map",
+			Usage:   "calculate the mAP of the validation set during training",
+			EnvVars: []string{"DARKNETW_NN_CALC_MAP"},
+			Value:   true,
+		},
+		&cli.IntFlag{
+			Name:    "mjpeg-port",
+			Usage:   "port serving the training chart as mjpeg (0 disables it)",
+			EnvVars: []string{"DARKNETW_NN_MJPEG_PORT"},
+			Value:   0,
+		},
+		&cli.BoolFlag{
+			Name:    "benchmark-layers",
+			Usage:   "report the time spent in each layer during training",
+			EnvVars: []string{"DARKNETW_NN_BENCHMARK_LAYERS"},
+			Value:   false,
+		},
+		&cli.BoolFlag{
+			Name:    "no-auto-cfg",
+			Usage:   "train with the network config as is, instead of adjusting its classes, filters, max_batches and steps to the number of class names",
+			EnvVars: []string{"DARKNETW_NN_NO_AUTO_CFG"},
+			Value:   false,
+		},
+	}
+}
+
 func ctxToCfg(ctx *cli.Context) *cfg.AppConfig {
 	return &cfg.AppConfig{
 		ServerConfig: &cfg.ServerConfig{
@@ -169,10 +438,29 @@ func ctxToCfg(ctx *cli.Context) *cfg.AppConfig {
 			Port: ctx.String("port"),
 		},
 		NeuralNetworkConfig: &cfg.NeuralNetworkConfig{
-			ConfigFile:  ctx.String("config"),
-			WeightsFile: ctx.String("weights"),
-			DataFile:    ctx.String("data"),
-			Clear:       ctx.Bool("clear"),
+			ConfigFile:    ctx.String("config"),
+			WeightsFile:   ctx.String("weights"),
+			DataFile:      ctx.String("data"),
+			Clear:         ctx.Bool("clear"),
+			Resume:        ctx.String("resume"),
+			GPUs:          ctx.IntSlice("gpus"),
+			CalcMAP:       ctx.Bool("calc-map"),
+			MJPEGPort:     ctx.Int("mjpeg-port"),
+			Benchmark:     ctx.Bool("benchmark-layers"),
+			NoAutoCfg:     ctx.Bool("no-auto-cfg"),
+			BackendName:   ctx.String("backend"),
+			Thresh:        ctx.Float64("thresh"),
+			HierThresh:    ctx.Float64("hier-thresh"),
+			NMS:           ctx.Float64("nms"),
+			PreResize:     ctx.Bool("pre-resize"),
+			PoolSize:      ctx.Int("pool-size"),
+			PoolQueueSize: ctx.Int("pool-queue"),
+			PoolWait:      ctx.Duration("pool-wait"),
+			BatchSize:     ctx.Int("batch-size"),
+			BatchWindow:   ctx.Duration("batch-window"),
+			WatchInterval: ctx.Duration("watch-interval"),
+			ModelsFile:    ctx.String("models"),
+			ModelsMemory:  ctx.Int64("models-memory") << 20,
 		},
 		Storage: ctx.String("storage"),
 	}
@@ -183,13 +471,34 @@ func serveAction(context *cli.Context) error {
 }
 
 func trainAction(ctx *cli.Context) error {
+	for _, name := range []string{"config", "data"} {
+		if ctx.String(name) == "" && ctx.String("resume") == "" {
+			return fmt.Errorf("required flag %q not set", name)
+		}
+	}
 	return train.Run(ctxToCfg(ctx))
 }
 
+func trainStopAction(ctx *cli.Context) error {
+	return train.Stop(ctxToCfg(ctx), ctx.Duration("wait"))
+}
+
 func validateAction(ctx *cli.Context) error {
 	return validate.Run(ctxToCfg(ctx))
 }
 
+func anchorsAction(ctx *cli.Context) error {
+	return anchors.Run(ctxToCfg(ctx), ctx.Int("anchors"), ctx.Int("width"), ctx.Int("height"), ctx.Bool("write"))
+}
+
+func datasetStatsAction(ctx *cli.Context) error {
+	return datasetcmd.Stats(ctxToCfg(ctx), ctx.Int("width"), ctx.Int("height"), ctx.Bool("json"))
+}
+
+func datasetCheckAction(ctx *cli.Context) error {
+	return datasetcmd.Check(ctxToCfg(ctx), ctx.Bool("fix"))
+}
+
 func generateAction(ctx *cli.Context) error {
 	return generate.Run(ctx.String("output"), ctx.Int("images"), ctx.Int("seed"))
 }
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MetricsFileName is the name of the file within a session directory recording every training iteration
+const MetricsFileName = "metrics.jsonl"
+
+// Metric is the progress reported by darknet after a training iteration
+type Metric struct {
+	Iteration int       `json:"iteration"`
+	Loss      float64   `json:"loss"`
+	AvgLoss   float64   `json:"avgLoss"`
+	Rate      float64   `json:"rate"` //learning rate
+	Images    int       `json:"images"`
+	HoursLeft float64   `json:"hoursLeft"`
+	MAP       *float64  `json:"mAP,omitempty"` //latest mAP, if calculated yet
+	Time      time.Time `json:"time"`
+}
+
+// MetricsWriter appends metrics to the metrics file of a session directory
+type MetricsWriter struct {
+	dir    string
+	fh     *os.File
+	enc    *json.Encoder
+	offset *int //iteration offset of the session, read on the first write
+}
+
+// OpenMetrics opens the metrics file of dir for appending
+func OpenMetrics(dir string) (*MetricsWriter, error) {
+	fh, err := os.OpenFile(filepath.Join(dir, MetricsFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &MetricsWriter{dir: dir, fh: fh, enc: json.NewEncoder(fh)}, nil
+}
+
+// Write appends m as a single line, its iteration offset by the iteration offset of the session so the iterations of
+// a session resumed with a cleared iteration count keep increasing
+func (w *MetricsWriter) Write(m *Metric) error {
+	if w.offset == nil {
+		//the session is read once training reports, by then a resumed session has recorded its resume
+		offset := 0
+		if s, err := Read(w.dir); err == nil {
+			offset = s.IterationOffset()
+		}
+		w.offset = &offset
+	}
+	recorded := *m
+	recorded.Iteration += *w.offset
+	return w.enc.Encode(&recorded)
+}
+
+func (w *MetricsWriter) Close() error {
+	return w.fh.Close()
+}
+
+// ReadMetrics reads the metrics of dir, oldest first. A session without metrics has none, and lines that can not be
+// parsed, such as one cut short by a crash, are skipped.
+func ReadMetrics(dir string) ([]*Metric, error) {
+	fh, err := os.Open(filepath.Join(dir, MetricsFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var metrics []*Metric
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		m := &Metric{}
+		if err := json.Unmarshal(scanner.Bytes(), m); err != nil {
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, scanner.Err()
+}
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	metrics, err := ReadMetrics(dir)
+	require.NoError(t, err)
+	require.Empty(t, metrics)
+
+	mAP := 0.5
+	w, err := OpenMetrics(dir)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(&Metric{Iteration: 1, Loss: 2, AvgLoss: 2}))
+	require.NoError(t, w.Write(&Metric{Iteration: 2, Loss: 1, AvgLoss: 1.9, MAP: &mAP}))
+	require.NoError(t, w.Close())
+
+	//a line cut short is skipped
+	fh, err := os.OpenFile(filepath.Join(dir, MetricsFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = fh.WriteString(`{"iteration":3,"lo`)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	metrics, err = ReadMetrics(dir)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	require.Equal(t, 1, metrics[0].Iteration)
+	require.Nil(t, metrics[0].MAP)
+	require.Equal(t, 1.9, metrics[1].AvgLoss)
+	require.Equal(t, 0.5, *metrics[1].MAP)
+}
+
+func TestMetricsWriter_IterationOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := OpenMetrics(dir)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(&Metric{Iteration: 100}))
+	require.NoError(t, w.Close())
+
+	//a session resumed with a cleared iteration count continues from the iterations recorded
+	s := &Session{Dir: dir, Status: Running, Resumes: []*Resume{{Clear: true, IterationOffset: 100}}}
+	require.NoError(t, s.Save())
+	w, err = OpenMetrics(dir)
+	require.NoError(t, err)
+	m := &Metric{Iteration: 1}
+	require.NoError(t, w.Write(m))
+	require.NoError(t, w.Close())
+	require.Equal(t, 1, m.Iteration)
+
+	metrics, err := ReadMetrics(dir)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	require.Equal(t, 100, metrics[0].Iteration)
+	require.Equal(t, 101, metrics[1].Iteration)
+}
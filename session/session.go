@@ -0,0 +1,227 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	Running     = "running"
+	Completed   = "completed"
+	Failed      = "failed"
+	Cancelled   = "cancelled"
+	Interrupted = "interrupted" //running according to the metadata, but no longer training
+	Unknown     = "unknown"     //created before sessions recorded any metadata
+)
+
+// FileName is the name of the metadata file within a session directory
+const FileName = "session.json"
+
+// Session is the metadata of a training session directory
+type Session struct {
+	ID              string                `json:"id"`
+	Status          string                `json:"status"`
+	Error           string                `json:"error,omitempty"`
+	Started         time.Time             `json:"started"`
+	Finished        *time.Time            `json:"finished,omitempty"`
+	Backend         string                `json:"backend,omitempty"`
+	Source          cfg.ModelConfig       `json:"source"`          //files the session was created from
+	StartingWeights string                `json:"startingWeights"` //relative to the session directory
+	Clear           bool                  `json:"clear"`
+	Options         *darknet.TrainOptions `json:"options,omitempty"` //darknet options the session trains with
+	Dataset         map[string]int        `json:"dataset"`           //number of images of each dataset split
+	Weights         []*Weights            `json:"weights"`           //relative to the session directory
+	PID             int                   `json:"pid,omitempty"`     //process running the session
+	Resumes         []*Resume             `json:"resumes,omitempty"`
+	Dir             string                `json:"-"`
+}
+
+// Weights is a weights file written by a training session
+type Weights struct {
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Resume records a training session being resumed
+type Resume struct {
+	Time    time.Time `json:"time"`
+	Weights string    `json:"weights"` //relative to the session directory
+	Clear   bool      `json:"clear"`
+	//iterations recorded before darknet last restarted counting, added to the iterations it reports since
+	IterationOffset int `json:"iterationOffset,omitempty"`
+}
+
+// ValidID reports whether id can name a session directory
+func ValidID(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id && !strings.ContainsAny(id, `/\`)
+}
+
+// Read reads the session of dir. Sessions without metadata are described as far as the directory allows.
+func Read(dir string) (*Session, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a session directory", dir)
+	}
+
+	s := &Session{}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, FileName))
+	if err == nil {
+		err = json.Unmarshal(buf, s)
+	}
+	if os.IsNotExist(err) {
+		s.Status = Unknown
+		s.Started, err = time.ParseInLocation(cfg.TimeFormatFS, filepath.Base(dir), time.Local)
+		if err != nil {
+			s.Started = fi.ModTime()
+		}
+		if _, e := os.Stat(filepath.Join(dir, "starting.weights")); e == nil {
+			s.StartingWeights = "starting.weights"
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.ID = filepath.Base(dir)
+	s.Dir = dir
+
+	s.Dataset = map[string]int{}
+	for _, split := range []string{"train", "valid"} {
+		if n, err := countLines(filepath.Join(dir, split+".txt")); err == nil {
+			s.Dataset[split] = n
+		}
+	}
+
+	s.Weights, err = readWeights(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List reads every session under base, ordered by start time
+func List(base string) ([]*Session, error) {
+	files, err := ioutil.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		s, err := Read(filepath.Join(base, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Started.Before(sessions[j].Started)
+	})
+	return sessions, nil
+}
+
+// Save writes the session metadata to the session directory
+func (s *Session) Save() error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.Dir, FileName+".tmp")
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, FileName))
+}
+
+// IterationOffset returns the number to add to the iterations darknet reports to keep the iterations of the session
+// increasing, as clearing the iteration count on resume restarts counting
+func (s *Session) IterationOffset() int {
+	if len(s.Resumes) == 0 {
+		return 0
+	}
+	return s.Resumes[len(s.Resumes)-1].IterationOffset
+}
+
+// CanResume returns an error unless the session was interrupted or cancelled, resuming a session that is still
+// running or has finished would train on the same weights twice
+func (s *Session) CanResume() error {
+	if s.Status != Interrupted && s.Status != Cancelled {
+		return fmt.Errorf("training session %s is %s, only interrupted or cancelled sessions can be resumed", s.ID, s.Status)
+	}
+	return nil
+}
+
+// Finish records the outcome of the session, a nil err completes it and context.Canceled cancels it
+func (s *Session) Finish(err error) error {
+	now := time.Now()
+	s.Finished = &now
+	s.Status = Completed
+	s.Error = ""
+	switch {
+	case err == context.Canceled:
+		s.Status = Cancelled
+	case err != nil:
+		s.Status = Failed
+		s.Error = err.Error()
+	}
+	return s.Save()
+}
+
+func readWeights(dir string) ([]*Weights, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dir, "weights"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var weights []*Weights
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".weights" {
+			continue
+		}
+		weights = append(weights, &Weights{
+			File:     filepath.Join("weights", f.Name()),
+			Size:     f.Size(),
+			Modified: f.ModTime(),
+		})
+	}
+	sort.SliceStable(weights, func(i, j int) bool {
+		return weights[i].Modified.Before(weights[j].Modified)
+	})
+	return weights, nil
+}
+
+func countLines(file string) (int, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n, nil
+}
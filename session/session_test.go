@@ -0,0 +1,57 @@
+package session
+
+import (
+	"github.com/netbrain/darknetw/cfg"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	base, err := ioutil.TempDir("", "sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(base)
+
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	legacy := filepath.Join(base, started.Format(cfg.TimeFormatFS))
+	require.NoError(t, os.MkdirAll(filepath.Join(legacy, "weights"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(legacy, "train.txt"), []byte("dataset/a.jpg\ndataset/b.jpg\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(legacy, "weights", "network_last.weights"), []byte("weights"), 0644))
+
+	recorded := &Session{
+		Dir:     filepath.Join(base, "recorded"),
+		Status:  Running,
+		Started: time.Now(),
+		Source:  cfg.ModelConfig{Config: "network.cfg", Data: "dataset.cfg"},
+	}
+	require.NoError(t, os.MkdirAll(recorded.Dir, 0755))
+	require.NoError(t, recorded.Save())
+	require.NoError(t, recorded.Finish(nil))
+
+	sessions, err := List(base)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	require.Equal(t, filepath.Base(legacy), sessions[0].ID)
+	require.Equal(t, Unknown, sessions[0].Status)
+	require.True(t, started.Equal(sessions[0].Started))
+	require.Equal(t, map[string]int{"train": 2}, sessions[0].Dataset)
+	require.Len(t, sessions[0].Weights, 1)
+	require.Equal(t, filepath.Join("weights", "network_last.weights"), sessions[0].Weights[0].File)
+	require.Equal(t, int64(7), sessions[0].Weights[0].Size)
+
+	require.Equal(t, "recorded", sessions[1].ID)
+	require.Equal(t, Completed, sessions[1].Status)
+	require.NotNil(t, sessions[1].Finished)
+	require.Equal(t, "network.cfg", sessions[1].Source.Config)
+}
+
+func TestValidID(t *testing.T) {
+	require.True(t, ValidID("02012006_150405"))
+	for _, id := range []string{"", ".", "..", "../train", "a/b"} {
+		require.False(t, ValidID(id), id)
+	}
+}
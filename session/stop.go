@@ -0,0 +1,80 @@
+package session
+
+import (
+	"errors"
+	"github.com/netbrain/darknetw/cfg"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrNotTraining is returned when stopping training while no session is training
+var ErrNotTraining = errors.New("currently not running a training session")
+
+// MarkInterrupted marks sessions left running as interrupted. While training, the latest running session is the one
+// training and keeps its status.
+func MarkInterrupted(sessions []*Session, training bool) {
+	for i := len(sessions) - 1; i >= 0; i-- {
+		s := sessions[i]
+		if s.Status != Running {
+			continue
+		}
+		if training {
+			training = false
+			continue
+		}
+		s.Status = Interrupted
+	}
+}
+
+// Training returns the session currently training
+func Training(config *cfg.AppConfig) (*Session, error) {
+	sessions, err := List(config.TrainingBasePath())
+	if err != nil {
+		return nil, err
+	}
+	MarkInterrupted(sessions, config.IsTraining())
+	for i := len(sessions) - 1; i >= 0; i-- {
+		if sessions[i].Status == Running {
+			return sessions[i], nil
+		}
+	}
+	return nil, ErrNotTraining
+}
+
+// Stop signals the process holding the training lock to cancel, which saves the latest weights, records the session
+// as cancelled and releases the training lock. Stop waits up to wait for the lock to be released and returns the
+// session as last recorded along with whether training has stopped.
+func Stop(config *cfg.AppConfig, wait time.Duration) (*Session, bool, error) {
+	s, err := Training(config)
+	if err != nil {
+		return nil, false, err
+	}
+	//the process of the session may have exited and its pid been reused, the lock file names the process training
+	pid, err := config.TrainingPID()
+	if err != nil {
+		return nil, false, err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return nil, false, err
+	}
+
+	deadline := time.Now().Add(wait)
+	stopped := false
+	for {
+		if stopped = !config.IsTraining(); stopped || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	s, err = Read(s.Dir)
+	if err != nil {
+		return nil, false, err
+	}
+	return s, stopped, nil
+}
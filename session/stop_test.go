@@ -0,0 +1,108 @@
+package session_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/netbrain/darknetw/cmd/train"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/fake"
+	"github.com/netbrain/darknetw/session"
+	"github.com/netbrain/darknetw/test"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// iterating is closed once the slow backend emits its first iteration
+var iterating = make(chan struct{})
+
+type iterationWriter struct {
+	once sync.Once
+}
+
+func (w *iterationWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("avg loss")) {
+		w.once.Do(func() {
+			close(iterating)
+		})
+	}
+	return len(p), nil
+}
+
+var resumeOutput = &bytes.Buffer{}
+
+func init() {
+	darknet.RegisterBackend("slow", &fake.Backend{Iterations: 100000, Interval: time.Millisecond, Output: &iterationWriter{}})
+	darknet.RegisterBackend("resume", &fake.Backend{Iterations: 100000, Output: resumeOutput})
+}
+
+func TestStop_Resume(t *testing.T) {
+	config, cleanup := test.BootstrapTestEnvironment()
+	defer cleanup()
+	config.BackendName = "slow"
+	config.GPUs = []int{1}
+	config.MJPEGPort = 8090
+	for _, f := range []string{"train.txt", "valid.txt"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(config.Storage, f), nil, 0644))
+	}
+
+	//training changes the working directory to the session directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+
+	_, _, err = session.Stop(config, time.Second)
+	require.Equal(t, session.ErrNotTraining, err)
+
+	done := make(chan error)
+	go func() {
+		done <- train.Run(config)
+	}()
+	select {
+	case <-iterating:
+	case <-time.After(5 * time.Second):
+		t.Fatal("training did not start")
+	}
+
+	pid, err := config.TrainingPID()
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), pid, "the training lock records the process training")
+
+	s, stopped, err := session.Stop(config, 5*time.Second)
+	require.NoError(t, err)
+	require.True(t, stopped)
+	require.Equal(t, session.Cancelled, s.Status)
+	require.NotNil(t, s.Finished)
+	require.NotEmpty(t, s.Weights)
+	require.Equal(t, filepath.Join("weights", "network_last.weights"), s.Weights[len(s.Weights)-1].File)
+	require.Equal(t, &darknet.TrainOptions{GPUs: []int{1}, CalcMAP: true, MJPEGPort: 8090}, s.Options)
+	require.Error(t, <-done)
+	require.False(t, config.IsTraining())
+
+	last, err := ioutil.ReadFile(filepath.Join(s.Dir, "weights", "network_last.weights"))
+	require.NoError(t, err)
+	var iteration int
+	_, err = fmt.Sscanf(string(last), "darknetw fake weights %d", &iteration)
+	require.NoError(t, err)
+
+	config.BackendName = "resume"
+	config.Resume = s.ID
+	config.GPUs = []int{2}
+	require.NoError(t, train.Run(config))
+
+	s, err = session.Read(s.Dir)
+	require.NoError(t, err)
+	require.Equal(t, session.Completed, s.Status)
+	require.Len(t, s.Resumes, 1)
+	require.Equal(t, []int{1}, s.Options.GPUs, "resuming keeps the options of the session")
+	require.Equal(t, filepath.Join("weights", "network_last.weights"), s.Resumes[0].Weights)
+	require.Contains(t, resumeOutput.String(), fmt.Sprintf("\n %d: ", iteration+1))
+	require.NotContains(t, resumeOutput.String(), fmt.Sprintf("\n %d: ", iteration))
+
+	err = train.Run(config)
+	require.EqualError(t, err, fmt.Sprintf("training session %s is completed, only interrupted or cancelled sessions can be resumed", s.ID))
+}
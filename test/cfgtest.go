@@ -2,7 +2,10 @@ package test
 
 import (
 	"github.com/netbrain/darknetw/cfg"
+	"github.com/netbrain/darknetw/darknet"
+	"github.com/netbrain/darknetw/darknet/fake"
 	"github.com/netbrain/darknetw/fs"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -12,8 +15,16 @@ func BootstrapTestEnvironment() (config *cfg.AppConfig, cleanup func()) {
 	tmpdir := filepath.Join(os.TempDir(), time.Now().Format(cfg.TimeFormatFS))
 	config = &cfg.AppConfig{
 		NeuralNetworkConfig: &cfg.NeuralNetworkConfig{
-			ConfigFile: filepath.Join(tmpdir, "network.cfg"),
-			DataFile:   filepath.Join(tmpdir, "dataset.cfg"),
+			ConfigFile:    filepath.Join(tmpdir, "network.cfg"),
+			DataFile:      filepath.Join(tmpdir, "dataset.cfg"),
+			WeightsFile:   filepath.Join(tmpdir, "network.weights"),
+			BackendName:   fake.BackendName,
+			Thresh:        darknet.DefaultThresh,
+			HierThresh:    darknet.DefaultHierThresh,
+			NMS:           darknet.DefaultNMS,
+			CalcMAP:       true,
+			PoolSize:      1,
+			PoolQueueSize: 16,
 		},
 		Storage:      tmpdir,
 		DatasetSplit: 0.1,
@@ -38,5 +49,10 @@ func BootstrapTestEnvironment() (config *cfg.AppConfig, cleanup func()) {
 		}
 	}
 
+	err = ioutil.WriteFile(config.WeightsFile, []byte("darknetw fake weights"), 0644)
+	if err != nil {
+		panic(err)
+	}
+
 	return
 }